@@ -8,9 +8,31 @@
 
 package main
 
-import "go-library/websocket"
+import (
+	"context"
+	"go-library/websocket"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
 
 func main() {
 
-	websocket.StartServer()
+	// 允许本地打开的 websocket/index.html，其 Origin 为 null
+	server := websocket.NewServer(&websocket.ServerConfig{AllowedOrigins: []string{"null"}})
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		<-quit
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}()
+	if err := server.Start(); err != nil {
+		log.Fatalln(err)
+	}
 }
@@ -0,0 +1,145 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_api_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 6:05 下午
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"go-library/websocket"
+)
+
+// apiRequest 调用后端推送接口并解析响应
+func apiRequest(t *testing.T, method string, url string, token string, body string, result interface{}) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// TestPushAPI 测试后端推送接口的鉴权、房间广播、私聊、全局公告与在线查询
+func TestPushAPI(t *testing.T) {
+	server := websocket.NewServer(&websocket.ServerConfig{API: &websocket.APIConfig{Token: "secret"}})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	alice := dialChat(t, ts.URL)
+	defer alice.Close()
+	login(alice, "r", "alice")
+	readUntil(t, alice, websocket.TypeLogin)
+
+	if status := apiRequest(t, http.MethodPost, ts.URL+"/api/announcements", "wrong", `{"content":"x"}`, nil); status != http.StatusUnauthorized {
+		t.Fatalf("status %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	var seq struct{ Seq int64 }
+	if status := apiRequest(t, http.MethodPost, ts.URL+"/api/rooms/r/messages", "secret", `{"from":"orders","content":"order shipped"}`, &seq); status != http.StatusOK {
+		t.Fatalf("status %d, want %d", status, http.StatusOK)
+	}
+	msg := readUntil(t, alice, websocket.TypeUser)
+	if msg.From != "orders" || msg.Seq != seq.Seq || textPayload(t, msg) != "order shipped" {
+		t.Fatalf("unexpected room message %+v", msg)
+	}
+	var missing websocket.NackPayload
+	if status := apiRequest(t, http.MethodPost, ts.URL+"/api/rooms/none/messages", "secret", `{"content":"x"}`, &missing); status != http.StatusNotFound || missing.Code != websocket.CodeRoomNotFound {
+		t.Fatalf("status %d code %d, want room not found", status, missing.Code)
+	}
+
+	// 服务端推送的默认发送方名称不能被用户占用
+	mallory := dialChat(t, ts.URL)
+	defer mallory.Close()
+	login(mallory, "r", "system")
+	if code := nackCode(t, readUntil(t, mallory, websocket.TypeNack)); code != websocket.CodeNameTaken {
+		t.Fatalf("nack code %d, want %d", code, websocket.CodeNameTaken)
+	}
+
+	apiRequest(t, http.MethodPost, ts.URL+"/api/users/alice/messages", "secret", `{"content":"parcel delivered"}`, nil)
+	if msg := readUntil(t, alice, websocket.TypeDirect); msg.From != "system" || textPayload(t, msg) != "parcel delivered" {
+		t.Fatalf("unexpected direct message %+v", msg)
+	}
+	var nack websocket.NackPayload
+	if status := apiRequest(t, http.MethodPost, ts.URL+"/api/users/bob/messages", "secret", `{"content":"x"}`, &nack); status != http.StatusNotFound || nack.Code != websocket.CodeUserOffline {
+		t.Fatalf("status %d code %d, want offline", status, nack.Code)
+	}
+
+	apiRequest(t, http.MethodPost, ts.URL+"/api/announcements", "secret", `{"content":"maintenance at 2am"}`, nil)
+	var system websocket.SystemPayload
+	if err := readUntil(t, alice, websocket.TypeSystem).DecodePayload(&system); err != nil || system.Action != websocket.ActionAnnouncement || system.Content != "maintenance at 2am" {
+		t.Fatalf("unexpected announcement %+v", system)
+	}
+
+	online := map[string]bool{}
+	apiRequest(t, http.MethodGet, ts.URL+"/api/users/online?user=alice&user=bob", "secret", "", &online)
+	if !online["alice"] || online["bob"] {
+		t.Fatalf("unexpected online status %v", online)
+	}
+}
+
+// TestPushAcrossNodes 测试多节点下的在线查询与全局公告
+func TestPushAcrossNodes(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	newNode := func(nodeId string) (*websocket.Server, *httptest.Server) {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		server := websocket.NewServer(&websocket.ServerConfig{
+			Backplane: websocket.NewBackplane(client, &websocket.BackplaneConfig{NodeId: nodeId}),
+		})
+		return server, httptest.NewServer(server.Handler())
+	}
+	server1, ts1 := newNode("node-1")
+	defer ts1.Close()
+	defer server1.Shutdown(context.Background())
+	server2, ts2 := newNode("node-2")
+	defer ts2.Close()
+	defer server2.Shutdown(context.Background())
+
+	bob := dialChat(t, ts2.URL)
+	defer bob.Close()
+	login(bob, "r", "bob")
+	readUntil(t, bob, websocket.TypeLogin)
+
+	online, err := server1.Online("bob", "carol")
+	if err != nil || !online["bob"] || online["carol"] {
+		t.Fatalf("unexpected online status %v %v", online, err)
+	}
+	if err := server1.SendToUser("bob", &websocket.PushMessage{Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, bob, websocket.TypeDirect)
+	if _, err := server1.BroadcastRoom("r", &websocket.PushMessage{Content: "room"}); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, bob, websocket.TypeUser)
+	server1.Announce("hello everyone")
+	var system websocket.SystemPayload
+	if err := readUntil(t, bob, websocket.TypeSystem).DecodePayload(&system); err != nil || system.Content != "hello everyone" {
+		t.Fatalf("unexpected announcement %+v", system)
+	}
+}
@@ -0,0 +1,94 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_auth_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 5:48 下午
+ */
+
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/encryption"
+	"go-library/websocket"
+)
+
+// TestWebSocketAuth 测试 token 鉴权握手与过期关闭
+func TestWebSocketAuth(t *testing.T) {
+	j := &encryption.Jwt{SecKey: secKey}
+	server := websocket.NewServer(&websocket.ServerConfig{
+		Auth: &websocket.AuthConfig{Jwt: j, Required: true},
+	})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+	newToken := func(uid int64, userAgent string, expires time.Duration) string {
+		claims := encryption.CustomClaims{Uid: uid, UserAgent: userAgent}
+		claims.ExpiresAt = time.Now().Add(expires).Unix()
+		token, err := j.GenerateToken(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	// 未携带 token
+	if _, resp, err := gws.DefaultDialer.Dial(url, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal("connection without token should be rejected")
+	}
+	// UserAgent 不一致
+	header := http.Header{"User-Agent": {"other"}}
+	if _, resp, err := gws.DefaultDialer.Dial(url+"?token="+newToken(1, "app", time.Minute), header); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal("token with mismatched user agent should be rejected")
+	}
+
+	// 通过 Sec-WebSocket-Protocol 携带 token
+	header = http.Header{"Sec-Websocket-Protocol": {"access_token, " + newToken(7, "", 2*time.Second)}}
+	ws, _, err := gws.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	var handshake websocket.HandshakePayload
+	if err := readUntil(t, ws, "handshake").DecodePayload(&handshake); err != nil || handshake.Uid != 7 {
+		t.Fatalf("handshake uid %d, want 7", handshake.Uid)
+	}
+	login(ws, "r", "someone-else")
+	if event := memberPayload(t, readUntil(t, ws, "login")); event.User != "7" {
+		t.Fatalf("login user %s, want 7", event.User)
+	}
+
+	// 刷新 token 后连接不应在原过期时间关闭
+	refresh := websocket.NewEnvelope(websocket.TypeRefresh, &websocket.RefreshPayload{Token: newToken(7, "", 4*time.Second)})
+	refresh.Id = "refresh-1"
+	_ = ws.WriteJSON(refresh)
+	readUntil(t, ws, "ack")
+	_ = ws.SetReadDeadline(time.Now().Add(2500 * time.Millisecond))
+	if _, _, err := ws.ReadMessage(); !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("connection closed before refreshed expiry: %v", err)
+	}
+
+	// 过期后连接被关闭
+	ws2, _, err := gws.DefaultDialer.Dial(url+"?token="+newToken(8, "", time.Second), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws2.Close()
+	_ = ws2.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		if _, _, err = ws2.ReadMessage(); err != nil {
+			break
+		}
+	}
+	if !gws.IsCloseError(err, websocket.CloseTokenExpired) {
+		t.Fatalf("unexpected close error %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_backplane_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 4:26 下午
+ */
+
+package tests
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"go-library/websocket"
+)
+
+// readUntil 读取消息直到出现指定类型
+func readUntil(t *testing.T, ws interface{ ReadJSON(v interface{}) error }, typ string) *websocket.Envelope {
+	for {
+		env := &websocket.Envelope{}
+		if err := ws.ReadJSON(env); err != nil {
+			t.Fatal(err)
+		}
+		if env.Type == typ {
+			return env
+		}
+	}
+}
+
+// TestBackplaneAcrossNodes 测试两个节点通过 redis 共享房间
+func TestBackplaneAcrossNodes(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	newNode := func(nodeId string, ttl time.Duration) (*websocket.Server, *redis.Client, *httptest.Server) {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		server := websocket.NewServer(&websocket.ServerConfig{
+			Backplane: websocket.NewBackplane(client, &websocket.BackplaneConfig{NodeId: nodeId, PresenceTTL: ttl}),
+		})
+		return server, client, httptest.NewServer(server.Handler())
+	}
+	server1, _, ts1 := newNode("node-1", time.Hour)
+	defer ts1.Close()
+	defer server1.Shutdown(context.Background())
+	_, client2, ts2 := newNode("node-2", 30*time.Second)
+	defer ts2.Close()
+
+	alice := dialChat(t, ts1.URL)
+	defer alice.Close()
+	login(alice, "r", "alice")
+	readUntil(t, alice, "login")
+
+	bob := dialChat(t, ts2.URL)
+	defer bob.Close()
+	login(bob, "r", "bob")
+	event := memberPayload(t, readUntil(t, bob, "login"))
+	if want := []string{"alice", "bob"}; !reflect.DeepEqual(userNames(event.UserList), want) {
+		t.Fatalf("user list %v, want %v", event.UserList, want)
+	}
+	// 其他节点的上线消息
+	if event = memberPayload(t, readUntil(t, alice, "login")); event.User != "bob" {
+		t.Fatalf("login user %s, want bob", event.User)
+	}
+
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "hi bob"})
+	if msg := readUntil(t, bob, "user"); msg.From != "alice" || textPayload(t, msg) != "hi bob" {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+
+	direct := websocket.NewEnvelope(websocket.TypeDirect, &websocket.TextPayload{Content: "secret"})
+	direct.Id, direct.To = "dm-1", "bob"
+	_ = alice.WriteJSON(direct)
+	if msg := readUntil(t, bob, "direct"); msg.From != "alice" || textPayload(t, msg) != "secret" {
+		t.Fatalf("unexpected direct message %+v", msg)
+	}
+	if ack := readUntil(t, alice, "ack"); ack.Id != "dm-1" {
+		t.Fatalf("unexpected ack %+v", ack)
+	}
+
+	// 模拟节点 2 崩溃，成员 key 过期后不再出现在用户列表中
+	_ = client2.Close()
+	mr.FastForward(time.Minute)
+	members, err := server1.RoomMembers("r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"alice"}; !reflect.DeepEqual(userNames(members), want) {
+		t.Fatalf("members %v, want %v", members, want)
+	}
+}
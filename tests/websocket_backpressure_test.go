@@ -0,0 +1,121 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_backpressure_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 10:20 下午
+ */
+
+package tests
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/websocket"
+)
+
+// floodRoom 向房间广播大消息直到 done 返回 true
+func floodRoom(t *testing.T, server *websocket.Server, room string, done func() bool) {
+	content := strings.Repeat("x", 32*1024)
+	deadline := time.Now().Add(10 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("slow consumer not detected before timeout")
+		}
+		if _, err := server.BroadcastRoom(room, &websocket.PushMessage{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestCompression 测试 permessage-deflate 协商
+func TestCompression(t *testing.T) {
+	server := websocket.NewServer(&websocket.ServerConfig{EnableCompression: true})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	dialer := &gws.Dialer{EnableCompression: true}
+	ws, resp, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if ext := resp.Header.Get("Sec-Websocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Fatalf("compression not negotiated, extensions %q", ext)
+	}
+	readUntil(t, ws, websocket.TypeHandshake)
+	login(ws, "r", "alice")
+	send(ws, websocket.TypeUser, "r", &websocket.TextPayload{Content: strings.Repeat("compress me ", 100)})
+	if content := textPayload(t, readUntil(t, ws, websocket.TypeUser)); content != strings.Repeat("compress me ", 100) {
+		t.Fatalf("unexpected content %q", content)
+	}
+}
+
+// TestSlowConsumer 测试慢消费者被断开时移出房间、广播下线并收到关闭帧，以及丢弃策略下保留连接
+func TestSlowConsumer(t *testing.T) {
+	server := websocket.NewServer(&websocket.ServerConfig{SendQueueSize: 8})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	alice := dialChat(t, ts.URL)
+	defer alice.Close()
+	login(alice, "r", "alice")
+	readUntil(t, alice, websocket.TypeLogin)
+	logouts := make(chan string, 1)
+	go func() {
+		for {
+			env := &websocket.Envelope{}
+			if err := alice.ReadJSON(env); err != nil {
+				return
+			}
+			if env.Type == websocket.TypeLogout {
+				logouts <- env.From
+			}
+		}
+	}()
+
+	bob := dialChat(t, ts.URL)
+	defer bob.Close()
+	login(bob, "r", "bob")
+	readUntil(t, bob, websocket.TypeLogin)
+	// bob 停止读取
+	floodRoom(t, server, "r", func() bool {
+		members, _ := server.RoomMembers("r")
+		return len(members) == 1
+	})
+	select {
+	case user := <-logouts:
+		if user != "bob" {
+			t.Fatalf("logout of %s, want bob", user)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("logout not broadcast")
+	}
+	for {
+		if _, _, err := bob.ReadMessage(); err != nil {
+			var ce *gws.CloseError
+			if !errors.As(err, &ce) || ce.Code != websocket.CloseSlowConsumer {
+				t.Fatalf("unexpected close %v", err)
+			}
+			break
+		}
+	}
+
+	// 丢弃最早消息时连接保留在房间中
+	server = websocket.NewServer(&websocket.ServerConfig{SendQueueSize: 8, SlowConsumer: websocket.SlowConsumerDropOldest})
+	ts2 := httptest.NewServer(server.Handler())
+	defer ts2.Close()
+	carol := dialChat(t, ts2.URL)
+	defer carol.Close()
+	login(carol, "r", "carol")
+	readUntil(t, carol, websocket.TypeLogin)
+	floodRoom(t, server, "r", func() bool { return server.SlowConsumerCount() > 0 })
+	if members, _ := server.RoomMembers("r"); len(members) != 1 {
+		t.Fatalf("members %v, want carol", members)
+	}
+}
@@ -0,0 +1,105 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_bot_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 10:10 下午
+ */
+
+package tests
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/logistics"
+	"go-library/websocket"
+)
+
+// fakeQuerier 测试用物流查询
+type fakeQuerier struct{}
+
+func (fakeQuerier) GetExpInfo(nu string, com string, phone string) ([]logistics.ExpInfo, string, error) {
+	if nu == "bad" {
+		return nil, "", errors.New("upstream unavailable")
+	}
+	return []logistics.ExpInfo{
+		{Time: "2026-10-20 10:00:00", Context: "派送中 " + com},
+		{Time: "2026-10-19 08:00:00", Context: "已揽收"},
+	}, "", nil
+}
+
+// readFrom 读取指定用户发送的房间消息内容
+func readFrom(t *testing.T, ws *gws.Conn, from string) string {
+	for {
+		if env := readUntil(t, ws, websocket.TypeUser); env.From == from {
+			return textPayload(t, env)
+		}
+	}
+}
+
+// TestBots 测试机器人加入房间、命令路由、限流与物流查询机器人
+func TestBots(t *testing.T) {
+	faq := websocket.NewBot(&websocket.BotConfig{Name: "faq", Rooms: []string{"r"}, Rate: 0.01, Burst: 1})
+	faq.Handle("hours", "营业时间", func(req *websocket.BotRequest) error {
+		return req.Reply("9:00-18:00 " + req.From)
+	})
+	if _, err := websocket.NewTrackingBot(&websocket.TrackingBotConfig{}); err != websocket.ErrQuerierRequired {
+		t.Fatalf("error %v, want %v", err, websocket.ErrQuerierRequired)
+	}
+	tracker, err := websocket.NewTrackingBot(&websocket.TrackingBotConfig{Querier: fakeQuerier{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := websocket.NewServer(&websocket.ServerConfig{Bots: []*websocket.Bot{faq, tracker}})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	alice := dialChat(t, ts.URL)
+	defer alice.Close()
+	login(alice, "r", "alice")
+	event := memberPayload(t, readUntil(t, alice, websocket.TypeLogin))
+	if names := userNames(event.UserList); strings.Join(names, ",") != "faq,logistics,alice" || !event.UserList[0].Bot {
+		t.Fatalf("unexpected user list %+v", event.UserList)
+	}
+
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "/track 7580 zto"})
+	if reply := readFrom(t, alice, "logistics"); !strings.Contains(reply, "7580") || !strings.Contains(reply, "派送中 zto") || !strings.Contains(reply, "已揽收") {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "/track bad"})
+	if reply := readFrom(t, alice, "logistics"); reply != websocket.ErrCommandFailed.Error() {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "/help@logistics"})
+	if reply := readFrom(t, alice, "logistics"); !strings.HasPrefix(reply, "/track ") {
+		t.Fatalf("unexpected help %q", reply)
+	}
+
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "/HOURS please"})
+	if reply := readFrom(t, alice, "faq"); reply != "9:00-18:00 alice" {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "/hours"})
+	waitFor(t, 2*time.Second, func() bool { return faq.Limited() == 1 })
+
+	// 机器人名称在所有房间中都不能被用户占用，未加入的房间中不出现机器人
+	bob := dialChat(t, ts.URL)
+	defer bob.Close()
+	login(bob, "r", "faq")
+	if code := nackCode(t, readUntil(t, bob, websocket.TypeNack)); code != websocket.CodeNameTaken {
+		t.Fatalf("nack code %d, want %d", code, websocket.CodeNameTaken)
+	}
+	login(bob, "other", "faq")
+	if code := nackCode(t, readUntil(t, bob, websocket.TypeNack)); code != websocket.CodeNameTaken {
+		t.Fatalf("nack code %d, want %d", code, websocket.CodeNameTaken)
+	}
+	login(bob, "other", "bob")
+	if names := userNames(memberPayload(t, readUntil(t, bob, websocket.TypeLogin)).UserList); strings.Join(names, ",") != "logistics,bob" {
+		t.Fatalf("unexpected user list %v", names)
+	}
+}
@@ -0,0 +1,177 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_codec_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 10:05 上午
+ */
+
+package tests
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/websocket"
+	"go-library/websocket/client"
+)
+
+// codecConn 按协商的编码读取消息
+type codecConn struct {
+	*gws.Conn
+	codec websocket.Codec
+}
+
+func (c *codecConn) ReadJSON(v interface{}) error {
+	messageType, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if messageType != c.codec.MessageType() {
+		return errors.New("unexpected frame type")
+	}
+	return c.codec.Unmarshal(data, v.(*websocket.Envelope))
+}
+
+// TestCodecRoundTrip 测试二进制编码的消息编解码
+func TestCodecRoundTrip(t *testing.T) {
+	env := websocket.NewEnvelope(websocket.TypeUser, &websocket.MemberPayload{User: "alice", Uid: 1 << 40, UserList: []*websocket.RoomUser{{Id: "alice", Name: "alice", Status: websocket.StatusOnline, Devices: 1}}})
+	env.Id, env.Seq, env.Room, env.Uid, env.From, env.To = "1", 7, "r", 1<<40, "alice", "bob"
+	env.Meta = map[string]string{"lang": "en", "region": "eu"}
+	for _, codec := range []websocket.Codec{websocket.MsgpackCodec{}, websocket.ProtobufCodec{}} {
+		data, err := codec.Marshal(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded websocket.Envelope
+		if err := codec.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		payload := memberPayload(t, &decoded)
+		if decoded.V != env.V || decoded.Id != "1" || decoded.Seq != 7 || decoded.Ts != env.Ts || decoded.Room != "r" ||
+			decoded.Uid != 1<<40 || decoded.From != "alice" || decoded.To != "bob" || decoded.Meta["region"] != "eu" {
+			t.Fatalf("%s: unexpected envelope %+v", codec.Name(), decoded)
+		}
+		if payload.User != "alice" || payload.Uid != 1<<40 || len(payload.UserList) != 1 {
+			t.Fatalf("%s: unexpected payload %+v", codec.Name(), payload)
+		}
+	}
+	if err := (websocket.ProtobufCodec{}).Unmarshal([]byte{0x0a, 0x05}, &websocket.Envelope{}); err == nil {
+		t.Fatal("expected malformed protobuf error")
+	}
+}
+
+// TestCodecNegotiation 测试通过子协议协商编码，不同编码的连接在同一房间内互通
+func TestCodecNegotiation(t *testing.T) {
+	server := websocket.NewServer(&websocket.ServerConfig{
+		Codecs: []websocket.Codec{websocket.MsgpackCodec{}, websocket.ProtobufCodec{}},
+	})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+	dialer := &gws.Dialer{Subprotocols: []string{"cbor", websocket.ProtocolMsgpack, websocket.ProtocolProtobuf}}
+	ws, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if ws.Subprotocol() != websocket.ProtocolMsgpack {
+		t.Fatalf("negotiated %q, want %q", ws.Subprotocol(), websocket.ProtocolMsgpack)
+	}
+	alice := &codecConn{Conn: ws, codec: websocket.MsgpackCodec{}}
+	readUntil(t, alice, websocket.TypeHandshake)
+	data, _ := alice.codec.Marshal(func() *websocket.Envelope {
+		env := websocket.NewEnvelope(websocket.TypeLogin, &websocket.LoginPayload{Name: "alice"})
+		env.Room = "r"
+		return env
+	}())
+	if err := ws.WriteMessage(gws.BinaryMessage, data); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, alice, websocket.TypeLogin)
+
+	bob, err := client.Dial(&client.Config{Url: url, Room: "r", Name: "bob", Codec: websocket.ProtobufCodec{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Close()
+	carol := dialChat(t, ts.URL)
+	defer carol.Close()
+	login(carol, "r", "carol")
+	readUntil(t, carol, websocket.TypeLogin)
+
+	seq, err := bob.Send("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := readUntil(t, alice, websocket.TypeUser); msg.Seq != seq || msg.From != "bob" || textPayload(t, msg) != "hello" {
+		t.Fatalf("unexpected msgpack message %+v", msg)
+	}
+	if msg := readUntil(t, carol, websocket.TypeUser); msg.Seq != seq || textPayload(t, msg) != "hello" {
+		t.Fatalf("unexpected json message %+v", msg)
+	}
+
+	// 服务端不支持的编码
+	if _, err := client.Dial(&client.Config{Url: url, Codec: unsupportedCodec{}, NoReconnect: true}); err != client.ErrCodec {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// unsupportedCodec 服务端未启用的编码
+type unsupportedCodec struct {
+	websocket.MsgpackCodec
+}
+
+func (unsupportedCodec) Name() string { return "cbor" }
+
+// failingCodec 房间消息编码总是失败的编码
+type failingCodec struct {
+	websocket.JSONCodec
+}
+
+func (failingCodec) Name() string { return "failing" }
+
+func (failingCodec) Marshal(env *websocket.Envelope) ([]byte, error) {
+	if env.Type == websocket.TypeUser || env.Type == websocket.TypeSystem {
+		return nil, errors.New("marshal failed")
+	}
+	return websocket.JSONCodec{}.Marshal(env)
+}
+
+// TestCodecFailureIsolated 测试某个连接的编码失败不影响其他连接收到广播与公告
+func TestCodecFailureIsolated(t *testing.T) {
+	server := websocket.NewServer(&websocket.ServerConfig{Codecs: []websocket.Codec{failingCodec{}}})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+	// 多个编码失败的连接，使 JSON 连接在房间遍历中大概率排在其后
+	dialer := &gws.Dialer{Subprotocols: []string{"failing"}}
+	for i := 0; i < 5; i++ {
+		ws, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+		readUntil(t, ws, websocket.TypeHandshake)
+		login(ws, "r", "failing"+string(rune('a'+i)))
+		readUntil(t, ws, websocket.TypeLogin)
+	}
+	alice := dialChat(t, ts.URL)
+	defer alice.Close()
+	login(alice, "r", "alice")
+	readUntil(t, alice, websocket.TypeLogin)
+
+	_ = alice.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 5; i++ {
+		send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "hi"})
+		readUntil(t, alice, websocket.TypeUser)
+		server.Announce("notice")
+		readUntil(t, alice, websocket.TypeSystem)
+	}
+}
@@ -0,0 +1,64 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_direct_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 6:52 下午
+ */
+
+package tests
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"go-library/websocket"
+)
+
+// TestDirectMessage 测试私聊消息投递到接收用户的所有连接
+func TestDirectMessage(t *testing.T) {
+	server := websocket.NewServer(nil)
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	tab1, tab2, bob := dialChat(t, ts.URL), dialChat(t, ts.URL), dialChat(t, ts.URL)
+	defer tab1.Close()
+	defer tab2.Close()
+	defer bob.Close()
+	login(tab1, "r1", "alice")
+	readUntil(t, tab1, "login")
+	login(tab2, "r2", "alice")
+	readUntil(t, tab2, "login")
+	login(bob, "r3", "bob")
+	readUntil(t, bob, "login")
+
+	direct := websocket.NewEnvelope(websocket.TypeDirect, &websocket.TextPayload{Content: "psst"})
+	direct.Id, direct.To = "dm-1", "alice"
+	_ = bob.WriteJSON(direct)
+	for _, ws := range []interface{ ReadJSON(v interface{}) error }{tab1, tab2} {
+		if msg := readUntil(t, ws, "direct"); msg.From != "bob" || textPayload(t, msg) != "psst" {
+			t.Fatalf("unexpected direct message %+v", msg)
+		}
+	}
+	if ack := readUntil(t, bob, "ack"); ack.Id != "dm-1" {
+		t.Fatalf("unexpected ack %+v", ack)
+	}
+
+	direct.Id, direct.To = "dm-2", "nobody"
+	_ = bob.WriteJSON(direct)
+	var nack websocket.NackPayload
+	if err := readUntil(t, bob, "nack").DecodePayload(&nack); err != nil || nack.Code != websocket.CodeUserOffline {
+		t.Fatalf("unexpected nack %+v", nack)
+	}
+
+	// 匿名用户不能使用纯数字用户名冒用鉴权用户的 uid
+	mallory := dialChat(t, ts.URL)
+	defer mallory.Close()
+	login(mallory, "r4", "42")
+	if err := readUntil(t, mallory, "nack").DecodePayload(&nack); err != nil || nack.Code != websocket.CodeInvalidPayload {
+		t.Fatalf("unexpected nack %+v", nack)
+	}
+	if online, _ := server.Online("42"); online["42"] {
+		t.Fatal("anonymous user registered as uid 42")
+	}
+}
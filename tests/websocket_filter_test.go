@@ -0,0 +1,101 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_filter_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 11:50 上午
+ */
+
+package tests
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-library/websocket"
+)
+
+// TestWordFilter 测试全角半角、拼音混写的敏感词匹配与热加载
+func TestWordFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# 敏感词\nbadword\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filter, err := websocket.NewWordFilter(&websocket.WordFilterConfig{
+		Words:          []string{"法轮功"},
+		Source:         &websocket.FileWordSource{Path: path},
+		ReloadInterval: 20 * time.Millisecond,
+		Pinyin:         websocket.PinyinTable{'法': "fa", '轮': "lun", '功': "gong"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filter.Close()
+
+	cases := map[string]string{
+		"这是ＢＡＤ word": "这是********",
+		"练fa轮gong的人": "练*******的人",
+		"法 轮 功":      "*****",
+		"正常消息":       "正常消息",
+	}
+	for content, want := range cases {
+		msg := &websocket.FilterMessage{Content: content}
+		if err := filter.Filter(msg); err != nil || msg.Content != want {
+			t.Fatalf("filter %q = %q, want %q", content, msg.Content, want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("badword\nspam\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 2*time.Second, func() bool { return len(filter.Match("no SPAM here")) == 1 })
+}
+
+// TestWordFilterDefaultPinyin 测试未设置拼音表时使用内置拼音表，设置为空表时不做拼音匹配
+func TestWordFilterDefaultPinyin(t *testing.T) {
+	filter, err := websocket.NewWordFilter(&websocket.WordFilterConfig{Words: []string{"法轮功"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filter.Close()
+	msg := &websocket.FilterMessage{Content: "练fa轮gong的人"}
+	if err := filter.Filter(msg); err != nil || msg.Content != "练*******的人" {
+		t.Fatalf("filter = %q, want %q", msg.Content, "练*******的人")
+	}
+
+	plain, err := websocket.NewWordFilter(&websocket.WordFilterConfig{Words: []string{"法轮功"}, Pinyin: websocket.PinyinTable{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	if hits := plain.Match("练fa轮gong的人"); len(hits) != 0 {
+		t.Fatalf("unexpected hits %v without pinyin", hits)
+	}
+}
+
+// TestMessageFilterChain 测试过滤链对房间消息的拒绝与掩码
+func TestMessageFilterChain(t *testing.T) {
+	mask, _ := websocket.NewWordFilter(&websocket.WordFilterConfig{Words: []string{"darn"}})
+	reject, _ := websocket.NewWordFilter(&websocket.WordFilterConfig{Words: []string{"forbidden"}, Action: websocket.FilterReject})
+	server := websocket.NewServer(&websocket.ServerConfig{Filters: []websocket.MessageFilter{reject, mask}})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	ws := dialChat(t, ts.URL)
+	defer ws.Close()
+	login(ws, "r", "alice")
+	readUntil(t, ws, websocket.TypeLogin)
+
+	send(ws, websocket.TypeUser, "r", &websocket.TextPayload{Content: "this is forbidden"})
+	var nack websocket.NackPayload
+	if err := readUntil(t, ws, websocket.TypeNack).DecodePayload(&nack); err != nil || nack.Code != websocket.CodeContentRejected {
+		t.Fatalf("code %d, want %d", nack.Code, websocket.CodeContentRejected)
+	}
+	send(ws, websocket.TypeUser, "r", &websocket.TextPayload{Content: "oh darn"})
+	if content := textPayload(t, readUntil(t, ws, websocket.TypeUser)); content != "oh ****" {
+		t.Fatalf("broadcast %q, want %q", content, "oh ****")
+	}
+}
@@ -0,0 +1,255 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_history_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/21 9:30 上午
+ */
+
+package tests
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/websocket"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// memoryHistoryStore 内存聊天记录存储
+type memoryHistoryStore struct {
+	mu       sync.Mutex
+	messages []websocket.Message
+	wait     func() // 不为空时 Recent 与 Since 查询前调用，用于模拟慢查询
+}
+
+func (s *memoryHistoryStore) Save(msg *websocket.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg.Id = int64(len(s.messages) + 1)
+	s.messages = append(s.messages, *msg)
+	return nil
+}
+
+func (s *memoryHistoryStore) LastSeq(room string) (seq int64, err error) {
+	for _, msg := range s.room(room) {
+		if msg.Seq > seq {
+			seq = msg.Seq
+		}
+	}
+	return
+}
+
+func (s *memoryHistoryStore) Recent(room string, limit int) ([]websocket.Message, error) {
+	s.slow()
+	messages := s.room(room)
+	if len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return messages, nil
+}
+
+func (s *memoryHistoryStore) Since(room string, seq int64, limit int) ([]websocket.Message, error) {
+	s.slow()
+	var messages []websocket.Message
+	for _, msg := range s.room(room) {
+		if msg.Seq > seq && len(messages) < limit {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func (s *memoryHistoryStore) Query(query *websocket.HistoryQuery) ([]websocket.Message, int64, error) {
+	return nil, 0, nil
+}
+
+func (s *memoryHistoryStore) setWait(wait func()) {
+	s.mu.Lock()
+	s.wait = wait
+	s.mu.Unlock()
+}
+
+func (s *memoryHistoryStore) slow() {
+	s.mu.Lock()
+	wait := s.wait
+	s.mu.Unlock()
+	if wait != nil {
+		wait()
+	}
+}
+
+// room 房间消息，按序号升序
+func (s *memoryHistoryStore) room(room string) []websocket.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var messages []websocket.Message
+	for _, msg := range s.messages {
+		if msg.Room == room && msg.To == "" {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+func (s *memoryHistoryStore) Export(room string, start time.Time, end time.Time, f func(msg *websocket.Message) error) error {
+	s.mu.Lock()
+	messages := append([]websocket.Message(nil), s.messages...)
+	s.mu.Unlock()
+	for i := range messages {
+		msg := &messages[i]
+		if msg.Room != room || (!start.IsZero() && msg.CreatedAt.Before(start)) || (!end.IsZero() && !msg.CreatedAt.Before(end)) {
+			continue
+		}
+		if err := f(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryHistoryStore) Purge(query *websocket.PurgeQuery) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	excluded := make(map[string]bool)
+	for _, room := range query.Exclude {
+		excluded[room] = true
+	}
+	kept := s.messages[:0]
+	var deleted int64
+	for _, msg := range s.messages {
+		match := msg.CreatedAt.Before(query.Before) && (msg.Room == query.Room || (query.Room == "" && !excluded[msg.Room]))
+		if match {
+			deleted++
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	s.messages = kept
+	return deleted, nil
+}
+
+// readSeqs 读取 n 条房间消息的序号
+func readSeqs(t *testing.T, ws *gws.Conn, n int) []int64 {
+	seqs := make([]int64, n)
+	for i := range seqs {
+		seqs[i] = readUntil(t, ws, websocket.TypeUser).Seq
+	}
+	return seqs
+}
+
+// TestHistoryReplay 测试登录时补发最近的消息、按序号补发、补发条数限制以及补发与实时消息不重复
+func TestHistoryReplay(t *testing.T) {
+	store := &memoryHistoryStore{}
+	for seq := int64(1); seq <= 5; seq++ {
+		_ = store.Save(&websocket.Message{Room: "r", Seq: seq, Type: websocket.TypeUser, From: "old", Content: "history", CreatedAt: time.Now()})
+	}
+	server := websocket.NewServer(&websocket.ServerConfig{History: store, HistoryReplay: 3})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	alice := dialChat(t, ts.URL)
+	defer alice.Close()
+	login(alice, "r", "alice")
+	readUntil(t, alice, websocket.TypeLogin)
+	if seqs := readSeqs(t, alice, 3); seqs[0] != 3 || seqs[1] != 4 || seqs[2] != 5 {
+		t.Fatalf("replayed %v, want [3 4 5]", seqs)
+	}
+
+	bob := dialChat(t, ts.URL)
+	defer bob.Close()
+	send(bob, websocket.TypeLogin, "r", &websocket.LoginPayload{Name: "bob", Seq: 1})
+	readUntil(t, bob, websocket.TypeLogin)
+	if seqs := readSeqs(t, bob, 3); seqs[0] != 2 || seqs[1] != 3 || seqs[2] != 4 {
+		t.Fatalf("replayed %v, want [2 3 4]", seqs)
+	}
+	readUntil(t, alice, websocket.TypeLogin)
+
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "live 6"})
+	if env := readUntil(t, bob, websocket.TypeUser); env.Seq != 6 {
+		t.Fatalf("live seq %d, want 6", env.Seq)
+	}
+	readUntil(t, alice, websocket.TypeUser)
+
+	// 查询聊天记录期间到达的消息在补发之后发送，已补发的消息不重复发送
+	entered, gate := make(chan struct{}), make(chan struct{})
+	store.setWait(func() {
+		entered <- struct{}{}
+		<-gate
+	})
+	carol := dialChat(t, ts.URL)
+	defer carol.Close()
+	login(carol, "r", "carol")
+	<-entered
+	store.setWait(nil)
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "live 7"})
+	if env := readUntil(t, alice, websocket.TypeUser); env.Seq != 7 {
+		t.Fatalf("live seq %d, want 7", env.Seq)
+	}
+	close(gate)
+	readUntil(t, carol, websocket.TypeLogin)
+	if seqs := readSeqs(t, carol, 3); seqs[0] != 5 || seqs[1] != 6 || seqs[2] != 7 {
+		t.Fatalf("replayed %v, want [5 6 7]", seqs)
+	}
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "live 8"})
+	if env := readUntil(t, carol, websocket.TypeUser); env.Seq != 8 || textPayload(t, env) != "live 8" {
+		t.Fatalf("unexpected live message %d %q", env.Seq, textPayload(t, env))
+	}
+}
+
+// sqlRecorder 记录 gorm 生成的 SQL
+type sqlRecorder struct {
+	gormlogger.Interface
+	mu   sync.Mutex
+	sqls []string
+}
+
+func (r *sqlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.mu.Lock()
+	r.sqls = append(r.sqls, sql)
+	r.mu.Unlock()
+}
+
+// TestGormHistoryQuery 测试聊天记录分页查询的过滤条件与分页大小限制
+func TestGormHistoryQuery(t *testing.T) {
+	recorder := &sqlRecorder{Interface: gormlogger.Discard}
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:pass@tcp(127.0.0.1:3306)/chat", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := websocket.NewGormHistoryStoreWithDB(db)
+	query := func(q *websocket.HistoryQuery) (string, string) {
+		recorder.sqls = nil
+		if _, _, err := store.Query(q); err != nil {
+			t.Fatal(err)
+		}
+		if len(recorder.sqls) != 2 {
+			t.Fatalf("unexpected sql %q", recorder.sqls)
+		}
+		return recorder.sqls[0], recorder.sqls[1]
+	}
+
+	count, find := query(&websocket.HistoryQuery{Room: "r", User: "bob", Type: websocket.TypeUser, Page: 3, PageSize: 1000})
+	for _, sql := range []string{count, find} {
+		if !strings.Contains(sql, "room = 'r' AND ((from_user = 'bob' OR to_user = 'bob')) AND type = 'user'") {
+			t.Fatalf("unexpected filter %s", sql)
+		}
+	}
+	if !strings.Contains(count, "count(*)") || !strings.HasSuffix(find, "ORDER BY id DESC LIMIT 500 OFFSET 1000") {
+		t.Fatalf("unexpected paging %s / %s", count, find)
+	}
+
+	_, find = query(&websocket.HistoryQuery{})
+	if strings.Contains(find, "WHERE") || !strings.HasSuffix(find, "ORDER BY id DESC LIMIT 20") {
+		t.Fatalf("unexpected default query %s", find)
+	}
+}
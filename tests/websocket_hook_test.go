@@ -0,0 +1,134 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_hook_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 4:45 下午
+ */
+
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-library/websocket"
+
+	gws "github.com/gorilla/websocket"
+)
+
+// recordingHook 记录生命周期事件并实现否决、改写与自定义消息类型
+type recordingHook struct {
+	websocket.BaseHook
+	mu     sync.Mutex
+	events []string
+}
+
+func (h *recordingHook) record(event string) {
+	h.mu.Lock()
+	h.events = append(h.events, event)
+	h.mu.Unlock()
+}
+
+func (h *recordingHook) has(event string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *recordingHook) OnConnect(conn *websocket.Conn, r *http.Request) error {
+	if r.URL.Query().Get("deny") != "" {
+		return errors.New("denied")
+	}
+	conn.Set("client", r.URL.Query().Get("client"))
+	h.record("connect")
+	return nil
+}
+
+func (h *recordingHook) OnLogin(conn *websocket.Conn, room string, payload *websocket.LoginPayload) error {
+	if payload.Name == "mallory" {
+		return &websocket.ProtocolError{Code: websocket.CodePermissionDenied, Message: "name not allowed"}
+	}
+	payload.Name = strings.ToLower(payload.Name)
+	h.record("login " + room)
+	return nil
+}
+
+func (h *recordingHook) OnMessage(conn *websocket.Conn, env *websocket.Envelope) error {
+	switch env.Type {
+	case "ping":
+		conn.Send(websocket.NewEnvelope("pong", nil))
+		return websocket.ErrMessageHandled
+	case websocket.TypeUser:
+		client, _ := conn.Get("client")
+		env.Meta = map[string]string{"client": client.(string)}
+	}
+	return nil
+}
+
+func (h *recordingHook) OnLogout(conn *websocket.Conn, room string) {
+	h.record("logout " + room)
+}
+
+func (h *recordingHook) OnDisconnect(conn *websocket.Conn) {
+	h.record("disconnect")
+}
+
+// TestHooks 测试钩子的否决、改写、补充字段与自定义消息类型
+func TestHooks(t *testing.T) {
+	hook := &recordingHook{}
+	server := websocket.NewServer(&websocket.ServerConfig{Hooks: []websocket.Hook{hook}})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/ws?deny=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	var ws *gws.Conn
+	ws, _, err = gws.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws?client=web", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, ws, websocket.TypeHandshake)
+	login(ws, "r", "mallory")
+	var nack websocket.NackPayload
+	if err := readUntil(t, ws, websocket.TypeNack).DecodePayload(&nack); err != nil || nack.Code != websocket.CodePermissionDenied {
+		t.Fatalf("code %d, want %d", nack.Code, websocket.CodePermissionDenied)
+	}
+	login(ws, "r", "Alice")
+	if member := memberPayload(t, readUntil(t, ws, websocket.TypeLogin)); member.User != "alice" {
+		t.Fatalf("login as %q, want %q", member.User, "alice")
+	}
+
+	send(ws, "ping", "r", nil)
+	readUntil(t, ws, "pong")
+
+	send(ws, websocket.TypeUser, "r", &websocket.TextPayload{Content: "hi"})
+	if msg := readUntil(t, ws, websocket.TypeUser); msg.Meta["client"] != "web" {
+		t.Fatalf("unexpected meta %v", msg.Meta)
+	}
+
+	_ = ws.Close()
+	waitFor(t, 2*time.Second, func() bool { return hook.has("disconnect") })
+	for _, event := range []string{"connect", "login r", "logout r"} {
+		if !hook.has(event) {
+			t.Fatalf("missing hook event %q", event)
+		}
+	}
+}
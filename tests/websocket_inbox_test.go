@@ -0,0 +1,134 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_inbox_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 7:50 下午
+ */
+
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	gws "github.com/gorilla/websocket"
+	"go-library/encryption"
+	"go-library/websocket"
+)
+
+// inboxPayload 解析收件箱消息内容
+func inboxPayload(t *testing.T, env *websocket.Envelope) *websocket.InboxPayload {
+	payload := &websocket.InboxPayload{}
+	if err := env.DecodePayload(payload); err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+// TestInbox 测试离线消息在登录时按顺序下发、实时下发、未读数与标记已读
+func TestInbox(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	j := &encryption.Jwt{SecKey: secKey}
+	server := websocket.NewServer(&websocket.ServerConfig{
+		Auth:  &websocket.AuthConfig{Jwt: j},
+		API:   &websocket.APIConfig{Token: "secret"},
+		Inbox: websocket.NewRedisInboxStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), &websocket.RedisInboxConfig{TTL: time.Hour}),
+	})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	for _, content := range []string{"order paid", "order shipped"} {
+		if _, err := server.SendToUid(7, &websocket.PushMessage{From: "orders", Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	claims := encryption.CustomClaims{Uid: 7}
+	claims.ExpiresAt = time.Now().Add(time.Minute).Unix()
+	token, err := j.GenerateToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, _, err := gws.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws?token="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	login(ws, "r", "")
+	inbox := inboxPayload(t, readUntil(t, ws, websocket.TypeInbox))
+	if inbox.Unread != 2 || len(inbox.Messages) != 2 || inbox.Messages[0].Content != "order paid" || inbox.Messages[1].Content != "order shipped" {
+		t.Fatalf("unexpected inbox %+v", inbox)
+	}
+
+	var result struct{ Id int64 }
+	apiRequest(t, http.MethodPost, ts.URL+"/api/inbox/7/messages", "secret", `{"content":"order delivered"}`, &result)
+	inbox = inboxPayload(t, readUntil(t, ws, websocket.TypeInbox))
+	if inbox.Unread != 3 || len(inbox.Messages) != 1 || inbox.Messages[0].Id != result.Id {
+		t.Fatalf("unexpected inbox %+v", inbox)
+	}
+
+	send(ws, websocket.TypeInboxRead, "", &websocket.InboxReadPayload{Id: inbox.Messages[0].Id - 1})
+	if inbox = inboxPayload(t, readUntil(t, ws, websocket.TypeInbox)); inbox.Unread != 1 {
+		t.Fatalf("unread %d, want 1", inbox.Unread)
+	}
+	var unread struct{ Unread int64 }
+	apiRequest(t, http.MethodGet, ts.URL+"/api/inbox/7/unread", "secret", "", &unread)
+	if unread.Unread != 1 {
+		t.Fatalf("unread %d, want 1", unread.Unread)
+	}
+}
+
+// TestRedisInboxCount 测试未读数不包含已过期的消息
+func TestRedisInboxCount(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	store := websocket.NewRedisInboxStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), &websocket.RedisInboxConfig{TTL: 50 * time.Millisecond})
+	for _, content := range []string{"expired", "expired"} {
+		if err := store.Push(&websocket.InboxMessage{Uid: 7, Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := store.Push(&websocket.InboxMessage{Uid: 7, Content: "fresh"}); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := store.Count(7); err != nil || count != 1 {
+		t.Fatalf("count %d (%v), want 1", count, err)
+	}
+	if messages, _ := store.Unread(7); len(messages) != 1 || messages[0].Content != "fresh" {
+		t.Fatalf("unexpected unread %+v", messages)
+	}
+
+	// 超出上限丢弃的消息与已读消息不计入未读数
+	store = websocket.NewRedisInboxStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), &websocket.RedisInboxConfig{MaxSize: 2})
+	for i := 0; i < 3; i++ {
+		if err := store.Push(&websocket.InboxMessage{Uid: 8, Content: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count, err := store.Count(8); err != nil || count != 2 {
+		t.Fatalf("count %d (%v), want 2", count, err)
+	}
+	if err := store.MarkRead(8, 2); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := store.Count(8); err != nil || count != 1 {
+		t.Fatalf("count %d (%v), want 1", count, err)
+	}
+	if messages, _ := store.Unread(8); len(messages) != 1 || messages[0].Id != 3 {
+		t.Fatalf("unexpected unread %+v", messages)
+	}
+}
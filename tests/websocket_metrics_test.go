@@ -0,0 +1,88 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_metrics_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 3:30 下午
+ */
+
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/logger"
+	"go-library/websocket"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// scrapeMetrics 获取 Prometheus 文本格式指标
+func scrapeMetrics(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// TestMetricsAndLogging 测试指标接口与结构化连接日志
+func TestMetricsAndLogging(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	server := websocket.NewServer(&websocket.ServerConfig{
+		MetricsPath: "/metrics",
+		Logger:      &logger.Logger{Logger: zap.New(core)},
+	})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	alice := dialChat(t, ts.URL)
+	login(alice, "r", "alice")
+	readUntil(t, alice, websocket.TypeLogin)
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "top secret"})
+	readUntil(t, alice, websocket.TypeUser)
+
+	metrics := scrapeMetrics(t, ts.URL+"/metrics")
+	for _, line := range []string{
+		"websocket_connections 1\n",
+		"websocket_rooms 1\n",
+		"websocket_connections_total 1\n",
+		"websocket_messages_received_total 2\n",
+		"# TYPE websocket_broadcast_latency_seconds histogram\n",
+		"websocket_broadcast_latency_seconds_bucket{le=\"+Inf\"} 1\n",
+	} {
+		if !strings.Contains(metrics, line) {
+			t.Fatalf("metrics missing %q:\n%s", line, metrics)
+		}
+	}
+
+	_ = alice.WriteMessage(gws.CloseMessage, gws.FormatCloseMessage(gws.CloseGoingAway, "bye"))
+	alice.Close()
+	waitFor(t, 2*time.Second, func() bool { return logs.FilterMessage("connection closed").Len() == 1 })
+	closed := logs.FilterMessage("connection closed").All()[0].ContextMap()
+	if closed["close_code"] != int64(gws.CloseGoingAway) || closed["room"] != "r" || closed["user"] != "alice" || closed["ip"] == "" {
+		t.Fatalf("unexpected close log %v", closed)
+	}
+	if logs.FilterMessage("joined room").Len() != 1 || logs.FilterMessage("connection opened").Len() != 1 {
+		t.Fatalf("missing lifecycle logs %v", logs.All())
+	}
+	for _, entry := range logs.All() {
+		for _, value := range entry.ContextMap() {
+			if s, ok := value.(string); ok && strings.Contains(s, "top secret") {
+				t.Fatalf("payload logged in %q", entry.Message)
+			}
+		}
+	}
+}
@@ -0,0 +1,225 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_moderation_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 11:58 下午
+ */
+
+package tests
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/encryption"
+	"go-library/websocket"
+)
+
+// memoryModerationStore 内存房间管理数据存储，模拟服务重启后的数据恢复
+type memoryModerationStore struct {
+	mu        sync.Mutex
+	settings  map[string]websocket.RoomSetting
+	roles     map[string]websocket.RoomRole
+	sanctions []websocket.RoomSanction
+}
+
+func (s *memoryModerationStore) LoadRoom(room string) (*websocket.RoomSetting, []websocket.RoomRole, []websocket.RoomSanction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var (
+		setting   *websocket.RoomSetting
+		roles     []websocket.RoomRole
+		sanctions []websocket.RoomSanction
+	)
+	if v, ok := s.settings[room]; ok {
+		setting = &v
+	}
+	for _, role := range s.roles {
+		if role.Room == room {
+			roles = append(roles, role)
+		}
+	}
+	for _, sanction := range s.sanctions {
+		if sanction.Room == room {
+			sanctions = append(sanctions, sanction)
+		}
+	}
+	return setting, roles, sanctions, nil
+}
+
+func (s *memoryModerationStore) SaveSetting(setting *websocket.RoomSetting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[setting.Room] = *setting
+	return nil
+}
+
+func (s *memoryModerationStore) SaveRole(role *websocket.RoomRole) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if role.Role == "" {
+		delete(s.roles, role.Room+"/"+role.User)
+	} else {
+		s.roles[role.Room+"/"+role.User] = *role
+	}
+	return nil
+}
+
+func (s *memoryModerationStore) AddSanction(sanction *websocket.RoomSanction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sanctions = append(s.sanctions, *sanction)
+	return nil
+}
+
+func (s *memoryModerationStore) RemoveSanctions(room string, kind string, user string, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sanctions := s.sanctions[:0]
+	for _, sanction := range s.sanctions {
+		if sanction.Room == room && sanction.Kind == kind && (user == "" || sanction.User == user) && (ip == "" || sanction.Ip == ip) {
+			continue
+		}
+		sanctions = append(sanctions, sanction)
+	}
+	s.sanctions = sanctions
+	return nil
+}
+
+// dialUid 以 uid 的 token 连接测试服务并读取握手消息
+func dialUid(t *testing.T, url string, j *encryption.Jwt, uid int64) *gws.Conn {
+	claims := encryption.CustomClaims{Uid: uid}
+	claims.ExpiresAt = time.Now().Add(time.Minute).Unix()
+	token, err := j.GenerateToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, _, err := gws.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws?token="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, ws, websocket.TypeHandshake)
+	return ws
+}
+
+// moderate 发送房间管理消息
+func moderate(ws *gws.Conn, payload *websocket.ModeratePayload) {
+	send(ws, websocket.TypeModerate, "r", payload)
+}
+
+// TestRoomModeration 测试房主、管理员权限与禁言、封禁、房间密码
+func TestRoomModeration(t *testing.T) {
+	store := &memoryModerationStore{settings: map[string]websocket.RoomSetting{}, roles: map[string]websocket.RoomRole{}}
+	j := &encryption.Jwt{SecKey: secKey}
+	config := &websocket.ServerConfig{Moderation: store, Auth: &websocket.AuthConfig{Jwt: j}}
+	server := websocket.NewServer(config)
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	nackCode := func(ws *gws.Conn) int {
+		var nack websocket.NackPayload
+		if err := readUntil(t, ws, websocket.TypeNack).DecodePayload(&nack); err != nil {
+			t.Fatal(err)
+		}
+		return nack.Code
+	}
+
+	// 匿名用户不会成为房主，首个加入的鉴权用户成为房主
+	mallory := dialChat(t, ts.URL)
+	defer mallory.Close()
+	login(mallory, "r", "mallory")
+	readUntil(t, mallory, websocket.TypeLogin)
+	alice, bob := dialUid(t, ts.URL, j, 1), dialChat(t, ts.URL)
+	defer alice.Close()
+	defer bob.Close()
+	login(alice, "r", "alice")
+	readUntil(t, alice, websocket.TypeLogin)
+	login(bob, "r", "bob")
+	readUntil(t, bob, websocket.TypeLogin)
+
+	moderate(mallory, &websocket.ModeratePayload{Action: websocket.ActionKick, User: "bob"})
+	if code := nackCode(mallory); code != websocket.CodePermissionDenied {
+		t.Fatalf("code %d, want %d", code, websocket.CodePermissionDenied)
+	}
+	moderate(bob, &websocket.ModeratePayload{Action: websocket.ActionKick, User: "1"})
+	if code := nackCode(bob); code != websocket.CodePermissionDenied {
+		t.Fatalf("code %d, want %d", code, websocket.CodePermissionDenied)
+	}
+	// 匿名用户不能被授予角色
+	moderate(alice, &websocket.ModeratePayload{Action: websocket.ActionRole, User: "bob", Role: websocket.RoleModerator})
+	if code := nackCode(alice); code != websocket.CodeInvalidPayload {
+		t.Fatalf("code %d, want %d", code, websocket.CodeInvalidPayload)
+	}
+
+	moderate(alice, &websocket.ModeratePayload{Action: websocket.ActionMute, User: "bob", Duration: 60})
+	var event websocket.SystemPayload
+	if err := readUntil(t, bob, websocket.TypeSystem).DecodePayload(&event); err != nil || event.Action != websocket.ActionMute || event.Until == 0 {
+		t.Fatalf("unexpected system event %+v", event)
+	}
+	readUntil(t, alice, websocket.TypeSystem)
+	send(bob, websocket.TypeUser, "r", &websocket.TextPayload{Content: "hello"})
+	if code := nackCode(bob); code != websocket.CodeMuted {
+		t.Fatalf("code %d, want %d", code, websocket.CodeMuted)
+	}
+
+	password := "secret"
+	moderate(alice, &websocket.ModeratePayload{Action: websocket.ActionSettings, Password: &password})
+	readUntil(t, alice, websocket.TypeSystem)
+	carol := dialUid(t, ts.URL, j, 3)
+	defer carol.Close()
+	login(carol, "r", "carol")
+	if code := nackCode(carol); code != websocket.CodeWrongPassword {
+		t.Fatalf("code %d, want %d", code, websocket.CodeWrongPassword)
+	}
+	send(carol, websocket.TypeLogin, "r", &websocket.LoginPayload{Name: "carol", Password: password})
+	readUntil(t, carol, websocket.TypeLogin)
+
+	// 封禁后连接被关闭，重启服务后封禁依然有效
+	moderate(alice, &websocket.ModeratePayload{Action: websocket.ActionBan, User: "3", Reason: "spam"})
+	_ = carol.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var err error
+	for err == nil {
+		_, _, err = carol.ReadMessage()
+	}
+	if !gws.IsCloseError(err, websocket.CloseKicked) {
+		t.Fatalf("unexpected close error %v", err)
+	}
+
+	restarted := websocket.NewServer(&websocket.ServerConfig{Moderation: store, Auth: config.Auth})
+	ts2 := httptest.NewServer(restarted.Handler())
+	defer ts2.Close()
+	carol = dialUid(t, ts2.URL, j, 3)
+	defer carol.Close()
+	send(carol, websocket.TypeLogin, "r", &websocket.LoginPayload{Name: "carol", Password: password})
+	if code := nackCode(carol); code != websocket.CodeBanned {
+		t.Fatalf("code %d, want %d", code, websocket.CodeBanned)
+	}
+	// 房主身份同样被保留
+	owner := dialUid(t, ts2.URL, j, 1)
+	defer owner.Close()
+	send(owner, websocket.TypeLogin, "r", &websocket.LoginPayload{Name: "alice", Password: password})
+	readUntil(t, owner, websocket.TypeLogin)
+	moderate(owner, &websocket.ModeratePayload{Action: websocket.ActionUnban, User: "3"})
+	readUntil(t, owner, websocket.TypeSystem)
+	send(carol, websocket.TypeLogin, "r", &websocket.LoginPayload{Name: "carol", Password: password})
+	readUntil(t, carol, websocket.TypeLogin)
+
+	// 封禁匿名用户时同时封禁其地址，更换用户名后仍无法加入
+	dave := dialChat(t, ts2.URL)
+	defer dave.Close()
+	send(dave, websocket.TypeLogin, "r", &websocket.LoginPayload{Name: "dave", Password: password})
+	readUntil(t, dave, websocket.TypeLogin)
+	moderate(owner, &websocket.ModeratePayload{Action: websocket.ActionBan, User: "dave"})
+	readUntil(t, owner, websocket.TypeSystem)
+	eve := dialChat(t, ts2.URL)
+	defer eve.Close()
+	send(eve, websocket.TypeLogin, "r", &websocket.LoginPayload{Name: "eve", Password: password})
+	if code := nackCode(eve); code != websocket.CodeBanned {
+		t.Fatalf("code %d, want %d", code, websocket.CodeBanned)
+	}
+}
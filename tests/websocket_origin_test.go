@@ -0,0 +1,127 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_origin_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 5:20 下午
+ */
+
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/websocket"
+)
+
+// dialHeader 携带请求头建立连接，返回握手消息中的客户端地址与响应状态码
+func dialHeader(t *testing.T, url string, header http.Header) (string, int) {
+	ws, resp, err := gws.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws", header)
+	if err != nil {
+		if resp == nil {
+			t.Fatal(err)
+		}
+		return "", resp.StatusCode
+	}
+	defer ws.Close()
+	var handshake websocket.HandshakePayload
+	if err := readUntil(t, ws, websocket.TypeHandshake).DecodePayload(&handshake); err != nil {
+		t.Fatal(err)
+	}
+	return handshake.Ip, resp.StatusCode
+}
+
+// TestOriginPolicy 测试默认同源检查与来源白名单
+func TestOriginPolicy(t *testing.T) {
+	ts := httptest.NewServer(websocket.NewServer(nil).Handler())
+	defer ts.Close()
+	if _, status := dialHeader(t, ts.URL, http.Header{"Origin": {"http://evil.test"}}); status != http.StatusForbidden {
+		t.Fatalf("cross origin status %d, want %d", status, http.StatusForbidden)
+	}
+	if _, status := dialHeader(t, ts.URL, http.Header{"Origin": {"null"}}); status != http.StatusForbidden {
+		t.Fatalf("null origin status %d, want %d", status, http.StatusForbidden)
+	}
+	if _, status := dialHeader(t, ts.URL, http.Header{"Origin": {ts.URL}}); status != http.StatusSwitchingProtocols {
+		t.Fatalf("same origin status %d", status)
+	}
+
+	server := websocket.NewServer(&websocket.ServerConfig{
+		AllowedOrigins: []string{"https://app.test", "*.example.com", "chat.test", "null"},
+		HTTPTransports: true,
+	})
+	ts = httptest.NewServer(server.Handler())
+	defer ts.Close()
+	for origin, want := range map[string]int{
+		"https://app.test":        http.StatusSwitchingProtocols,
+		"http://app.test":         http.StatusForbidden,
+		"https://a.example.com":   http.StatusSwitchingProtocols,
+		"https://example.com":     http.StatusForbidden,
+		"https://evilexample.com": http.StatusForbidden,
+		"http://chat.test:8080":   http.StatusSwitchingProtocols,
+		"null":                    http.StatusSwitchingProtocols,
+		ts.URL:                    http.StatusForbidden,
+	} {
+		if _, status := dialHeader(t, ts.URL, http.Header{"Origin": {origin}}); status != want {
+			t.Fatalf("origin %s status %d, want %d", origin, status, want)
+		}
+	}
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/ws/poll", nil)
+	req.Header.Set("Origin", "https://evil.test")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("poll status %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
+
+// TestTrustedProxy 测试可信代理转发的客户端地址用于握手消息与连接数限制
+func TestTrustedProxy(t *testing.T) {
+	ts := httptest.NewServer(websocket.NewServer(nil).Handler())
+	defer ts.Close()
+	if ip, _ := dialHeader(t, ts.URL, http.Header{"X-Forwarded-For": {"203.0.113.7"}}); ip != "127.0.0.1" {
+		t.Fatalf("untrusted proxy ip %s", ip)
+	}
+
+	server := websocket.NewServer(&websocket.ServerConfig{
+		TrustedProxies: []string{"127.0.0.0/8", "10.0.0.1"},
+		RateLimit:      &websocket.RateLimitConfig{MaxConnectionsPerIp: 1},
+	})
+	ts = httptest.NewServer(server.Handler())
+	defer ts.Close()
+	for _, c := range []struct {
+		header http.Header
+		want   string
+	}{
+		{http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7, 10.0.0.1"}}, "203.0.113.7"},
+		{http.Header{"X-Forwarded-For": {"198.51.100.1", "10.0.0.1"}}, "198.51.100.1"},
+		{http.Header{"X-Forwarded-For": {"bogus, 10.0.0.1"}}, "10.0.0.1"},
+		{http.Header{"X-Real-Ip": {"198.51.100.2"}}, "198.51.100.2"},
+		{http.Header{}, "127.0.0.1"},
+	} {
+		if ip, _ := dialHeader(t, ts.URL, c.header); ip != c.want {
+			t.Fatalf("header %v ip %s, want %s", c.header, ip, c.want)
+		}
+	}
+
+	waitFor(t, 2*time.Second, func() bool { return server.ConnectionCount() == 0 })
+	// 同一代理后的不同客户端分别计算连接数
+	alice, _, err := gws.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", http.Header{"X-Forwarded-For": {"198.51.100.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+	if _, status := dialHeader(t, ts.URL, http.Header{"X-Forwarded-For": {"198.51.100.9"}}); status != http.StatusSwitchingProtocols {
+		t.Fatalf("status %d for another client", status)
+	}
+	if _, status := dialHeader(t, ts.URL, http.Header{"X-Forwarded-For": {"198.51.100.1"}}); status != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want %d", status, http.StatusTooManyRequests)
+	}
+}
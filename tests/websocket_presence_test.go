@@ -0,0 +1,113 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_presence_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 8:10 下午
+ */
+
+package tests
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/encryption"
+	"go-library/websocket"
+)
+
+// userNames 用户列表中的显示名称
+func userNames(users []*websocket.RoomUser) []string {
+	names := make([]string, len(users))
+	for i, u := range users {
+		names[i] = u.Name
+	}
+	return names
+}
+
+// nackCode 解析失败消息的错误码
+func nackCode(t *testing.T, env *websocket.Envelope) int {
+	payload := &websocket.NackPayload{}
+	if err := env.DecodePayload(payload); err != nil {
+		t.Fatal(err)
+	}
+	return payload.Code
+}
+
+// TestPresence 测试同一用户多个连接只出现一次、显示名称唯一与在线状态广播
+func TestPresence(t *testing.T) {
+	j := &encryption.Jwt{SecKey: secKey}
+	server := websocket.NewServer(&websocket.ServerConfig{Auth: &websocket.AuthConfig{Jwt: j}})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	dialUid := func(uid int64) *gws.Conn {
+		claims := encryption.CustomClaims{Uid: uid}
+		claims.ExpiresAt = time.Now().Add(time.Minute).Unix()
+		token, err := j.GenerateToken(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ws, _, err := gws.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws?token="+token, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readUntil(t, ws, websocket.TypeHandshake)
+		return ws
+	}
+
+	tab1 := dialUid(1)
+	defer tab1.Close()
+	login(tab1, "r", "Alice")
+	readUntil(t, tab1, websocket.TypeLogin)
+	tab2 := dialUid(1)
+	defer tab2.Close()
+	login(tab2, "r", "Alice")
+	event := memberPayload(t, readUntil(t, tab2, websocket.TypeLogin))
+	if len(event.UserList) != 1 || event.UserList[0].Id != "1" || event.UserList[0].Name != "Alice" || event.UserList[0].Devices != 2 {
+		t.Fatalf("unexpected user list %+v", event.UserList)
+	}
+
+	bob := dialChat(t, ts.URL)
+	defer bob.Close()
+	login(bob, "r", "bob")
+	if event = memberPayload(t, readUntil(t, tab1, websocket.TypeLogin)); event.User != "bob" || len(event.UserList) != 2 {
+		t.Fatalf("unexpected login %+v", event)
+	}
+	readUntil(t, bob, websocket.TypeLogin)
+
+	// 其他用户不能使用已被占用的显示名称
+	carol := dialChat(t, ts.URL)
+	defer carol.Close()
+	login(carol, "r", "Alice")
+	if code := nackCode(t, readUntil(t, carol, websocket.TypeNack)); code != websocket.CodeNameTaken {
+		t.Fatalf("nack code %d, want %d", code, websocket.CodeNameTaken)
+	}
+
+	send(tab2, websocket.TypePresence, "r", &websocket.PresencePayload{Status: "sleeping"})
+	if code := nackCode(t, readUntil(t, tab2, websocket.TypeNack)); code != websocket.CodeInvalidPayload {
+		t.Fatalf("nack code %d, want %d", code, websocket.CodeInvalidPayload)
+	}
+	send(tab2, websocket.TypePresence, "r", &websocket.PresencePayload{Status: websocket.StatusAway})
+	var user websocket.RoomUser
+	if err := readUntil(t, bob, websocket.TypePresence).DecodePayload(&user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Id != "1" || user.Status != websocket.StatusAway {
+		t.Fatalf("unexpected presence %+v", user)
+	}
+
+	// 关闭一个连接后用户仍在线，最后一个连接关闭后才下线
+	_ = tab2.Close()
+	waitFor(t, 2*time.Second, func() bool {
+		members, _ := server.RoomMembers("r")
+		return len(members) == 2 && members[0].Devices == 1
+	})
+	_ = tab1.Close()
+	if event = memberPayload(t, readUntil(t, bob, websocket.TypeLogout)); event.User != "1" || event.Name != "Alice" || len(event.UserList) != 1 {
+		t.Fatalf("unexpected logout %+v", event)
+	}
+}
@@ -0,0 +1,125 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_protocol_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 9:35 下午
+ */
+
+package tests
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/websocket"
+)
+
+// TestProtocolAckNack 测试消息确认、错误码与重试去重
+func TestProtocolAckNack(t *testing.T) {
+	server := websocket.NewServer(nil)
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	ws := dialChat(t, ts.URL)
+	defer ws.Close()
+
+	nackCode := func() int {
+		var nack websocket.NackPayload
+		if err := readUntil(t, ws, websocket.TypeNack).DecodePayload(&nack); err != nil {
+			t.Fatal(err)
+		}
+		return nack.Code
+	}
+	_ = ws.WriteMessage(gws.TextMessage, []byte("{not json"))
+	if code := nackCode(); code != websocket.CodeMalformedMessage {
+		t.Fatalf("code %d, want %d", code, websocket.CodeMalformedMessage)
+	}
+	_ = ws.WriteJSON(&websocket.Envelope{V: 99, Type: websocket.TypeUser})
+	if code := nackCode(); code != websocket.CodeUnsupportedVersion {
+		t.Fatalf("code %d, want %d", code, websocket.CodeUnsupportedVersion)
+	}
+	send(ws, "unknown", "r", nil)
+	if code := nackCode(); code != websocket.CodeUnknownType {
+		t.Fatalf("code %d, want %d", code, websocket.CodeUnknownType)
+	}
+	send(ws, websocket.TypeUser, "r", &websocket.TextPayload{Content: "before login"})
+	if code := nackCode(); code != websocket.CodeNotLoggedIn {
+		t.Fatalf("code %d, want %d", code, websocket.CodeNotLoggedIn)
+	}
+
+	login(ws, "r", "alice")
+	readUntil(t, ws, websocket.TypeLogin)
+
+	// 同一消息标识重复提交只广播一次，并返回相同的序号
+	msg := websocket.NewEnvelope(websocket.TypeUser, &websocket.TextPayload{Content: "once"})
+	msg.Id, msg.Room = "client-1", "r"
+	_ = ws.WriteJSON(msg)
+	// 广播与 ack 的到达顺序不固定
+	var broadcast, ack *websocket.Envelope
+	for broadcast == nil || ack == nil {
+		env := &websocket.Envelope{}
+		if err := ws.ReadJSON(env); err != nil {
+			t.Fatal(err)
+		}
+		switch env.Type {
+		case websocket.TypeUser:
+			broadcast = env
+		case websocket.TypeAck:
+			ack = env
+		}
+	}
+	if ack.Id != "client-1" || ack.Seq != broadcast.Seq || ack.Seq == 0 {
+		t.Fatalf("unexpected ack %+v for broadcast seq %d", ack, broadcast.Seq)
+	}
+	_ = ws.WriteJSON(msg)
+	if retry := readUntil(t, ws, websocket.TypeAck); retry.Seq != ack.Seq {
+		t.Fatalf("retry seq %d, want %d", retry.Seq, ack.Seq)
+	}
+
+	next := websocket.NewEnvelope(websocket.TypeUser, &websocket.TextPayload{Content: "twice"})
+	next.Id, next.Room = "client-2", "r"
+	_ = ws.WriteJSON(next)
+	// 重试未产生新的广播，下一条广播即为新消息
+	if env := readUntil(t, ws, websocket.TypeUser); textPayload(t, env) != "twice" || env.Seq != ack.Seq+1 {
+		t.Fatalf("unexpected broadcast %+v", env)
+	}
+}
+
+// TestProtocolSeqOrder 测试多个用户同时发送时房间消息按序号顺序投递
+func TestProtocolSeqOrder(t *testing.T) {
+	server := websocket.NewServer(nil)
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	observer := dialChat(t, ts.URL)
+	defer observer.Close()
+	login(observer, "r", "observer")
+	readUntil(t, observer, websocket.TypeLogin)
+
+	const senders, count = 4, 25
+	conns := make([]*gws.Conn, senders)
+	for i := range conns {
+		conns[i] = dialChat(t, ts.URL)
+		defer conns[i].Close()
+		login(conns[i], "r", fmt.Sprintf("sender%d", i))
+		readUntil(t, conns[i], websocket.TypeLogin)
+	}
+	for _, ws := range conns {
+		go func(ws *gws.Conn) {
+			for i := 0; i < count; i++ {
+				send(ws, websocket.TypeUser, "r", &websocket.TextPayload{Content: "hi"})
+			}
+		}(ws)
+	}
+	var last int64
+	for i := 0; i < senders*count; i++ {
+		env := readUntil(t, observer, websocket.TypeUser)
+		if env.Seq != last+1 {
+			t.Fatalf("seq %d after %d", env.Seq, last)
+		}
+		last = env.Seq
+	}
+}
@@ -0,0 +1,91 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_ratelimit_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 10:40 上午
+ */
+
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/websocket"
+)
+
+// TestRateLimit 测试消息限流、临时禁言、断开连接与地址连接数限制
+func TestRateLimit(t *testing.T) {
+	server := websocket.NewServer(&websocket.ServerConfig{
+		RateLimit: &websocket.RateLimitConfig{
+			MessagesPerSecond:   1,
+			MessageBurst:        2,
+			MaxConnectionsPerIp: 2,
+			MuteAfter:           2,
+			DisconnectAfter:     4,
+		},
+	})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	ws := dialChat(t, ts.URL)
+	defer ws.Close()
+	other := dialChat(t, ts.URL)
+	defer other.Close()
+	if _, resp, err := gws.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil); err == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatal("connection over the per ip limit should be rejected")
+	}
+
+	for i := 1; i <= 6; i++ {
+		env := websocket.NewEnvelope("unknown", nil)
+		env.Id = fmt.Sprintf("m%d", i)
+		_ = ws.WriteJSON(env)
+	}
+	_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	codes := map[string]int{}
+	muted := false
+	var err error
+	for {
+		env := &websocket.Envelope{}
+		if err = ws.ReadJSON(env); err != nil {
+			break
+		}
+		switch env.Type {
+		case websocket.TypeNack:
+			var nack websocket.NackPayload
+			_ = env.DecodePayload(&nack)
+			codes[env.Id] = nack.Code
+		case websocket.TypeSystem:
+			muted = true
+		}
+	}
+	if !gws.IsCloseError(err, gws.ClosePolicyViolation) {
+		t.Fatalf("unexpected close error %v", err)
+	}
+	if codes["m2"] != websocket.CodeUnknownType || codes["m3"] != websocket.CodeRateLimited || codes["m5"] != websocket.CodeRateLimited {
+		t.Fatalf("unexpected nack codes %v", codes)
+	}
+	if !muted {
+		t.Fatal("expected a mute warning before disconnect")
+	}
+	stats := server.RateLimitStats()
+	if stats.Limited != 4 || stats.Mutes != 1 || stats.Disconnects != 1 || stats.RejectedConnections != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// 连接断开后释放地址的连接数
+	waitFor(t, 2*time.Second, func() bool {
+		again, _, err := gws.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil)
+		if err != nil {
+			return false
+		}
+		_ = again.Close()
+		return true
+	})
+}
@@ -0,0 +1,112 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_receipt_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 9:05 下午
+ */
+
+package tests
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-library/websocket"
+)
+
+// TestTypingReceiptRecall 测试正在输入节流、已读回执与撤回时限
+func TestTypingReceiptRecall(t *testing.T) {
+	server := websocket.NewServer(&websocket.ServerConfig{TypingInterval: time.Minute, RecallWindow: 500 * time.Millisecond})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	alice := dialChat(t, ts.URL)
+	defer alice.Close()
+	login(alice, "r", "alice")
+	readUntil(t, alice, websocket.TypeLogin)
+	bob := dialChat(t, ts.URL)
+	defer bob.Close()
+	login(bob, "r", "bob")
+	readUntil(t, bob, websocket.TypeLogin)
+
+	carol := dialChat(t, ts.URL)
+	defer carol.Close()
+	login(carol, "other", "carol")
+	readUntil(t, carol, websocket.TypeLogin)
+
+	// 状态未变化的重复输入通知被节流，停止输入立即转发
+	for _, typing := range []bool{true, true, false} {
+		send(alice, websocket.TypeTyping, "r", &websocket.TypingPayload{Typing: typing})
+	}
+	for _, want := range []bool{true, false} {
+		var payload websocket.TypingPayload
+		env := readUntil(t, bob, websocket.TypeTyping)
+		if err := env.DecodePayload(&payload); err != nil || env.From != "alice" || payload.Typing != want {
+			t.Fatalf("typing %v from %s, want %v", payload.Typing, env.From, want)
+		}
+	}
+
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "hello"})
+	var msg *websocket.Envelope
+	for msg == nil {
+		env := &websocket.Envelope{}
+		if err := bob.ReadJSON(env); err != nil {
+			t.Fatal(err)
+		}
+		switch env.Type {
+		case websocket.TypeTyping:
+			t.Fatal("typing not throttled")
+		case websocket.TypeUser:
+			msg = env
+		}
+	}
+
+	// 回执只发送给同一房间内的用户
+	receipt := websocket.NewEnvelope(websocket.TypeRead, &websocket.ReceiptPayload{Seq: msg.Seq})
+	receipt.Room, receipt.To = "r", "carol"
+	_ = bob.WriteJSON(receipt)
+	receipt.To = msg.From
+	_ = bob.WriteJSON(receipt)
+	var read websocket.ReceiptPayload
+	if env := readUntil(t, alice, websocket.TypeRead); env.DecodePayload(&read) != nil || env.From != "bob" || read.Seq != msg.Seq {
+		t.Fatalf("unexpected receipt %+v from %s", read, env.From)
+	}
+	dave := dialChat(t, ts.URL)
+	defer dave.Close()
+	login(dave, "other", "dave")
+	for {
+		env := &websocket.Envelope{}
+		if err := carol.ReadJSON(env); err != nil {
+			t.Fatal(err)
+		}
+		if env.Type == websocket.TypeRead {
+			t.Fatal("receipt delivered outside the room")
+		}
+		if env.Type == websocket.TypeLogin {
+			break
+		}
+	}
+
+	// 不能撤回他人的消息
+	send(bob, websocket.TypeRecall, "r", &websocket.RecallPayload{Seq: msg.Seq})
+	var nack websocket.NackPayload
+	if err := readUntil(t, bob, websocket.TypeNack).DecodePayload(&nack); err != nil || nack.Code != websocket.CodeRecallDenied {
+		t.Fatalf("code %d, want %d", nack.Code, websocket.CodeRecallDenied)
+	}
+	send(alice, websocket.TypeRecall, "r", &websocket.RecallPayload{Seq: msg.Seq})
+	var recall websocket.RecallPayload
+	if env := readUntil(t, bob, websocket.TypeRecall); env.DecodePayload(&recall) != nil || env.From != "alice" || recall.Seq != msg.Seq {
+		t.Fatalf("unexpected recall %+v", recall)
+	}
+
+	// 超过撤回时限
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "too late"})
+	msg = readUntil(t, alice, websocket.TypeUser)
+	time.Sleep(600 * time.Millisecond)
+	send(alice, websocket.TypeRecall, "r", &websocket.RecallPayload{Seq: msg.Seq})
+	if err := readUntil(t, alice, websocket.TypeNack).DecodePayload(&nack); err != nil || nack.Code != websocket.CodeRecallDenied {
+		t.Fatalf("code %d, want %d", nack.Code, websocket.CodeRecallDenied)
+	}
+}
@@ -0,0 +1,166 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_room_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 3:02 下午
+ */
+
+package tests
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/websocket"
+)
+
+// dialChat 连接测试服务并读取握手消息
+func dialChat(t *testing.T, url string) *gws.Conn {
+	ws, _, err := gws.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env websocket.Envelope
+	if err := ws.ReadJSON(&env); err != nil {
+		t.Fatal(err)
+	}
+	return ws
+}
+
+// send 发送协议消息
+func send(ws *gws.Conn, typ string, room string, payload interface{}) {
+	env := websocket.NewEnvelope(typ, payload)
+	env.Room = room
+	_ = ws.WriteJSON(env)
+}
+
+// login 登录房间
+func login(ws *gws.Conn, room string, name string) {
+	send(ws, websocket.TypeLogin, room, &websocket.LoginPayload{Name: name})
+}
+
+// memberPayload 解析上下线消息内容
+func memberPayload(t *testing.T, env *websocket.Envelope) *websocket.MemberPayload {
+	payload := &websocket.MemberPayload{}
+	if err := env.DecodePayload(payload); err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+// textPayload 解析文本消息内容
+func textPayload(t *testing.T, env *websocket.Envelope) string {
+	payload := &websocket.TextPayload{}
+	if err := env.DecodePayload(payload); err != nil {
+		t.Fatal(err)
+	}
+	return payload.Content
+}
+
+// drain 持续读取消息直到连接关闭
+func drain(ws *gws.Conn) {
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// waitFor 在超时时间内等待条件成立
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRoomConcurrentJoinLeave 测试并发进出房间，需配合 -race 运行
+func TestRoomConcurrentJoinLeave(t *testing.T) {
+	server := websocket.NewServer(&websocket.ServerConfig{RoomIdleTimeout: 50 * time.Millisecond})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	const clients, rounds = 20, 10
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				for _, room := range server.Rooms() {
+					_, _ = server.RoomMembers(room.Name)
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	conns := make([]*gws.Conn, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ws := dialChat(t, ts.URL)
+			conns[i] = ws
+			go drain(ws)
+			for j := 0; j < rounds; j++ {
+				room := fmt.Sprintf("room-%d", (i+j)%3)
+				login(ws, room, fmt.Sprintf("user-%d", i))
+				send(ws, websocket.TypeUser, room, &websocket.TextPayload{Content: "hello"})
+				if j%2 == 0 {
+					send(ws, websocket.TypeLogout, room, nil)
+				}
+			}
+			login(ws, "final", fmt.Sprintf("user-%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	waitFor(t, 2*time.Second, func() bool {
+		info, err := server.Room("final")
+		return err == nil && len(info.Members) == clients && info.Count == clients
+	})
+	close(stop)
+
+	// 所有连接断开后空房间应被销毁
+	for _, ws := range conns {
+		_ = ws.Close()
+	}
+	waitFor(t, 2*time.Second, func() bool { return server.RoomCount() == 0 })
+}
+
+// TestHeartbeatEvictsDeadPeer 测试不响应心跳的连接被移出房间并广播下线消息
+func TestHeartbeatEvictsDeadPeer(t *testing.T) {
+	server := websocket.NewServer(&websocket.ServerConfig{
+		PingInterval: 50 * time.Millisecond,
+		PongWait:     200 * time.Millisecond,
+	})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	alive, dead := dialChat(t, ts.URL), dialChat(t, ts.URL)
+	defer alive.Close()
+	defer dead.Close()
+	login(alive, "r", "alive")
+	readUntil(t, alive, "login")
+	// dead 登录后不再读取消息，也就不会响应 ping
+	login(dead, "r", "dead")
+	readUntil(t, alive, "login")
+
+	// alive 持续读取以响应 ping，并应收到 dead 的下线消息
+	_ = alive.SetReadDeadline(time.Now().Add(2 * time.Second))
+	logout := memberPayload(t, readUntil(t, alive, "logout"))
+	if logout.User != "dead" || len(logout.UserList) != 1 || logout.UserList[0].Name != "alive" {
+		t.Fatalf("unexpected logout %+v", logout)
+	}
+}
@@ -0,0 +1,133 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_session_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 10:55 下午
+ */
+
+package tests
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gws "github.com/gorilla/websocket"
+	"go-library/encryption"
+	"go-library/websocket"
+)
+
+// TestSessionResume 测试断线重连后恢复会话并补发断线期间的消息
+func TestSessionResume(t *testing.T) {
+	server := websocket.NewServer(&websocket.ServerConfig{ResumeWindow: 500 * time.Millisecond})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+	dial := func() (*gws.Conn, string) {
+		ws, _, err := gws.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var handshake websocket.HandshakePayload
+		if err := readUntil(t, ws, websocket.TypeHandshake).DecodePayload(&handshake); err != nil || handshake.Session == "" {
+			t.Fatalf("handshake without session: %v", err)
+		}
+		return ws, handshake.Session
+	}
+
+	alice, session := dial()
+	bob, _ := dial()
+	defer bob.Close()
+	login(alice, "r", "alice")
+	readUntil(t, alice, websocket.TypeLogin)
+	login(bob, "r", "bob")
+	readUntil(t, bob, websocket.TypeLogin)
+	readUntil(t, alice, websocket.TypeLogin)
+	send(bob, websocket.TypeUser, "r", &websocket.TextPayload{Content: "seen"})
+	seen := readUntil(t, alice, websocket.TypeUser)
+
+	// alice 断线期间 bob 发送的消息在恢复后补发
+	_ = alice.Close()
+	waitFor(t, 2*time.Second, func() bool { return server.ConnectionCount() == 1 })
+	send(bob, websocket.TypeUser, "r", &websocket.TextPayload{Content: "missed-1"})
+	send(bob, websocket.TypeUser, "r", &websocket.TextPayload{Content: "missed-2"})
+
+	alice, _ = dial()
+	defer alice.Close()
+	resume := websocket.NewEnvelope(websocket.TypeResume, &websocket.ResumePayload{Session: session, Seq: seen.Seq})
+	resume.Id = "resume-1"
+	_ = alice.WriteJSON(resume)
+	if members := memberPayload(t, readUntil(t, alice, websocket.TypeResume)); members.User != "alice" || len(members.UserList) != 2 {
+		t.Fatalf("unexpected resume %+v", members)
+	}
+	for _, want := range []string{"missed-1", "missed-2"} {
+		if content := textPayload(t, readUntil(t, alice, websocket.TypeUser)); content != want {
+			t.Fatalf("replayed %q, want %q", content, want)
+		}
+	}
+	readUntil(t, alice, websocket.TypeAck)
+
+	// 恢复后身份不变，bob 不应收到 alice 的上下线消息
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "back"})
+	for {
+		env := &websocket.Envelope{}
+		if err := bob.ReadJSON(env); err != nil {
+			t.Fatal(err)
+		}
+		if env.Type == websocket.TypeLogin || env.Type == websocket.TypeLogout {
+			t.Fatalf("unexpected %s broadcast", env.Type)
+		}
+		if env.Type == websocket.TypeUser && textPayload(t, env) == "back" {
+			if env.From != "alice" {
+				t.Fatalf("from %s, want alice", env.From)
+			}
+			break
+		}
+	}
+
+	// 会话只能恢复一次，且超过恢复窗口后广播下线
+	other, _ := dial()
+	defer other.Close()
+	send(other, websocket.TypeResume, "", &websocket.ResumePayload{Session: session})
+	var nack websocket.NackPayload
+	if err := readUntil(t, other, websocket.TypeNack).DecodePayload(&nack); err != nil || nack.Code != websocket.CodeSessionExpired {
+		t.Fatalf("code %d, want %d", nack.Code, websocket.CodeSessionExpired)
+	}
+	_ = alice.Close()
+	_ = bob.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if logout := memberPayload(t, readUntil(t, bob, websocket.TypeLogout)); logout.User != "alice" {
+		t.Fatalf("logout user %s, want alice", logout.User)
+	}
+}
+
+// TestSessionResumeIdentity 测试鉴权连接不能恢复匿名会话
+func TestSessionResumeIdentity(t *testing.T) {
+	j := &encryption.Jwt{SecKey: secKey}
+	server := websocket.NewServer(&websocket.ServerConfig{ResumeWindow: time.Second, Auth: &websocket.AuthConfig{Jwt: j}})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	anonymous, _, err := gws.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handshake websocket.HandshakePayload
+	if err := readUntil(t, anonymous, websocket.TypeHandshake).DecodePayload(&handshake); err != nil {
+		t.Fatal(err)
+	}
+	login(anonymous, "r", "guest")
+	readUntil(t, anonymous, websocket.TypeLogin)
+	_ = anonymous.Close()
+	waitFor(t, 2*time.Second, func() bool { return server.ConnectionCount() == 0 })
+
+	ws := dialUid(t, ts.URL, j, 1)
+	defer ws.Close()
+	_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	send(ws, websocket.TypeResume, "", &websocket.ResumePayload{Session: handshake.Session})
+	if code := nackCode(t, readUntil(t, ws, websocket.TypeNack)); code != websocket.CodeInvalidToken {
+		t.Fatalf("nack code %d, want %d", code, websocket.CodeInvalidToken)
+	}
+}
@@ -9,9 +9,193 @@
 package tests
 
 import (
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"go-library/websocket"
+	"go-library/websocket/client"
 )
 
+// trackingListener 记录已接受的连接，用于模拟网络中断
+type trackingListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+// drop 断开第 i 个连接
+func (l *trackingListener) drop(i int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_ = l.conns[i].Close()
+}
+
+// receiveMessage 在超时时间内读取一条消息
+func receiveMessage(t *testing.T, ch <-chan *client.Message) *client.Message {
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received before timeout")
+	}
+	return nil
+}
+
+// receiveUserEvent 在超时时间内读取一个用户列表事件
+func receiveUserEvent(t *testing.T, ch <-chan *client.UserEvent) *client.UserEvent {
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("user event not received before timeout")
+	}
+	return nil
+}
+
+// receiveState 在超时时间内读取一个连接状态事件
+func receiveState(t *testing.T, ch <-chan bool) bool {
+	select {
+	case connected := <-ch:
+		return connected
+	case <-time.After(2 * time.Second):
+		t.Fatal("state not received before timeout")
+	}
+	return false
+}
+
 func TestWebSocket(t *testing.T) {
+	server := websocket.NewServer(nil)
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+	alice, err := client.Dial(&client.Config{Url: url, Room: "r", Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+	users := make(chan *client.UserEvent, 10)
+	alice.SubscribeUsers(func(event *client.UserEvent) { users <- event })
+	messages := make(chan *client.Message, 10)
+	alice.SubscribeRoom(func(msg *client.Message) { messages <- msg })
+	directs := make(chan *client.Message, 10)
+	alice.SubscribeDirect(func(msg *client.Message) { directs <- msg })
+
+	bob, err := client.Dial(&client.Config{Url: url, Room: "r", Name: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 订阅前已排队的自身上线消息可能同样分发给订阅者
+	event := receiveUserEvent(t, users)
+	if event.User == "alice" {
+		event = receiveUserEvent(t, users)
+	}
+	if event.Type != websocket.TypeLogin || event.User != "bob" || len(event.Users) != 2 {
+		t.Fatalf("unexpected user event %+v", event)
+	}
+
+	seq, err := bob.Send("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := receiveMessage(t, messages); msg.From != "bob" || msg.Content != "hello" || msg.Seq != seq {
+		t.Fatalf("unexpected message %+v, seq %d", msg, seq)
+	}
+	if err := bob.SendDirect("alice", "psst"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receiveMessage(t, directs); msg.From != "bob" || msg.To != "alice" || msg.Content != "psst" {
+		t.Fatalf("unexpected direct message %+v", msg)
+	}
+	var pe *websocket.ProtocolError
+	if err := bob.SendDirect("nobody", "hi"); !errors.As(err, &pe) || pe.Code != websocket.CodeUserOffline {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	_ = bob.Close()
+	if event := receiveUserEvent(t, users); event.Type != websocket.TypeLogout || event.User != "bob" {
+		t.Fatalf("unexpected user event %+v", event)
+	}
+	if list := alice.Users(); len(list) != 1 || list[0].Name != "alice" {
+		t.Fatalf("unexpected user list %v", list)
+	}
+}
+
+// TestClientReconnect 测试网络中断后客户端自动重连、恢复会话并收到断线期间的消息
+func TestClientReconnect(t *testing.T) {
+	server := websocket.NewServer(&websocket.ServerConfig{ResumeWindow: 5 * time.Second})
+	ts := httptest.NewUnstartedServer(server.Handler())
+	listener := &trackingListener{Listener: ts.Listener}
+	ts.Listener = listener
+	ts.Start()
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+	alice, err := client.Dial(&client.Config{Url: url, Room: "r", Name: "alice", ReconnectMin: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+	states := make(chan bool, 10)
+	alice.SubscribeState(func(connected bool) { states <- connected })
+	// 连接状态变化不经过消息订阅分发
+	untyped := make(chan *websocket.Envelope, 10)
+	alice.Subscribe("", func(env *websocket.Envelope) { untyped <- env })
+	alice.Subscribe("client.state", func(env *websocket.Envelope) { untyped <- env })
+	messages := make(chan *client.Message, 10)
+	alice.SubscribeRoom(func(msg *client.Message) { messages <- msg })
+
+	bob, err := client.Dial(&client.Config{Url: url, Room: "r", Name: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Close()
+	users := make(chan *client.UserEvent, 10)
+	bob.SubscribeUsers(func(event *client.UserEvent) { users <- event })
 
+	listener.drop(0)
+	if receiveState(t, states) {
+		t.Fatal("expected a disconnected state")
+	}
+	waitFor(t, 2*time.Second, func() bool { return server.ConnectionCount() == 1 })
+	for _, content := range []string{"missed-1", "missed-2"} {
+		if _, err := bob.Send(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !receiveState(t, states) {
+		t.Fatal("expected a reconnected state")
+	}
+	for _, want := range []string{"missed-1", "missed-2"} {
+		if msg := receiveMessage(t, messages); msg.Content != want {
+			t.Fatalf("received %q, want %q", msg.Content, want)
+		}
+	}
+	if _, err := alice.Send("back"); err != nil {
+		t.Fatal(err)
+	}
+	// 会话恢复不产生 alice 的上下线消息
+	for len(users) > 0 {
+		if event := <-users; event.User == "alice" {
+			t.Fatalf("unexpected user event %+v", event)
+		}
+	}
+	if len(untyped) > 0 {
+		t.Fatalf("state delivered as message %+v", <-untyped)
+	}
 }
@@ -0,0 +1,157 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_transcript_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 11:50 下午
+ */
+
+package tests
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-library/websocket"
+)
+
+// TestTranscriptExport 测试按时间范围导出 JSON、CSV 与纯文本聊天记录
+func TestTranscriptExport(t *testing.T) {
+	store := &memoryHistoryStore{}
+	base := time.Date(2026, 10, 1, 9, 0, 0, 0, time.Local)
+	for i, msg := range []websocket.Message{
+		{Room: "r", Seq: 1, Type: websocket.TypeUser, From: "alice", Content: "too early", CreatedAt: base.Add(-time.Hour)},
+		{Room: "r", Seq: 2, Type: websocket.TypeUser, From: "alice", Content: "hello, \"bob\"", CreatedAt: base},
+		{Room: "other", Seq: 1, Type: websocket.TypeUser, From: "carol", Content: "elsewhere", CreatedAt: base},
+		{Room: "r", Seq: 3, Type: websocket.TypeUser, From: "bob", Content: "oops", Recalled: true, CreatedAt: base.Add(time.Minute)},
+	} {
+		msg := msg
+		if err := store.Save(&msg); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	server := websocket.NewServer(&websocket.ServerConfig{History: store, API: &websocket.APIConfig{Token: "secret"}})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	export := func(format string) (string, string) {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/rooms/r/transcript?format="+format+"&start="+base.Format(time.RFC3339), nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("format %s status %d: %s", format, resp.StatusCode, body)
+		}
+		return string(body), resp.Header.Get("Content-Disposition")
+	}
+
+	body, disposition := export(websocket.ExportJSON)
+	var messages []websocket.Message
+	if err := json.Unmarshal([]byte(body), &messages); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Content != "hello, \"bob\"" || !messages[1].Recalled || !strings.Contains(disposition, "r.json") {
+		t.Fatalf("unexpected json export %s (%s)", body, disposition)
+	}
+
+	body, _ = export(websocket.ExportCSV)
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0][7] != "content" || records[1][7] != "hello, \"bob\"" || records[2][9] != "true" {
+		t.Fatalf("unexpected csv export %q", records)
+	}
+
+	// 可能被电子表格当作公式的字段加 ' 前缀
+	_ = store.Save(&websocket.Message{Room: "@formula", Seq: 1, Type: websocket.TypeUser, From: "=cmd", To: "@bob", Content: "+SUM(A1)", CreatedAt: base})
+	var buf strings.Builder
+	if err := server.ExportTranscript(&buf, &websocket.TranscriptQuery{Room: "@formula", Format: websocket.ExportCSV}); err != nil {
+		t.Fatal(err)
+	}
+	if records, err = csv.NewReader(strings.NewReader(buf.String())).ReadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][1] != "'@formula" || records[1][5] != "'=cmd" || records[1][6] != "'@bob" || records[1][7] != "'+SUM(A1)" {
+		t.Fatalf("unexpected csv export %q", records)
+	}
+
+	body, _ = export(websocket.ExportText)
+	if want := "[2026-10-01 09:00:00] alice: hello, \"bob\"\n[2026-10-01 09:01:00] bob: oops [已撤回]\n"; body != want {
+		t.Fatalf("text export %q, want %q", body, want)
+	}
+
+	// 多行内容的后续行缩进，不能伪造新的记录行
+	_ = store.Save(&websocket.Message{Room: "lines", Seq: 1, Type: websocket.TypeUser, From: "eve", Content: "hi\r\n[2026-10-01 09:05:00] admin: fake", CreatedAt: base})
+	buf.Reset()
+	if err := server.ExportTranscript(&buf, &websocket.TranscriptQuery{Room: "lines", Format: websocket.ExportText}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[2026-10-01 09:00:00] eve: hi\n    [2026-10-01 09:05:00] admin: fake\n"; buf.String() != want {
+		t.Fatalf("text export %q, want %q", buf.String(), want)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/rooms/r/transcript?format=xml", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+// TestRetention 测试默认保留天数与按房间设置的保留天数
+func TestRetention(t *testing.T) {
+	store := &memoryHistoryStore{}
+	now := time.Now()
+	for _, msg := range []websocket.Message{
+		{Room: "r", Content: "old", CreatedAt: now.AddDate(0, 0, -40)},
+		{Room: "r", Content: "recent", CreatedAt: now.AddDate(0, 0, -10)},
+		{Room: "audit", Content: "kept", CreatedAt: now.AddDate(0, 0, -40)},
+		{Room: "short", Content: "expired", CreatedAt: now.AddDate(0, 0, -2)},
+		{Room: "forever", Content: "kept", CreatedAt: now.AddDate(0, 0, -400)},
+	} {
+		msg := msg
+		_ = store.Save(&msg)
+	}
+	retention := websocket.NewRetention(&websocket.RetentionConfig{
+		Store: store,
+		Days:  30,
+		Rooms: map[string]int{"audit": 90, "short": 1, "forever": 0},
+	})
+	deleted, err := retention.Purge(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 || len(store.messages) != 3 {
+		t.Fatalf("deleted %d, remaining %+v", deleted, store.messages)
+	}
+	for _, msg := range store.messages {
+		if msg.Content == "old" || msg.Content == "expired" {
+			t.Fatalf("message %+v not purged", msg)
+		}
+	}
+
+	// 定时任务启动时立即清理一次
+	_ = store.Save(&websocket.Message{Room: "r", Content: "old", CreatedAt: now.AddDate(0, 0, -40)})
+	retention.Start()
+	defer retention.Stop()
+	waitFor(t, 2*time.Second, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.messages) == 3
+	})
+}
@@ -0,0 +1,147 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  websocket_transport_test
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 11:50 下午
+ */
+
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-library/websocket"
+)
+
+// sseStream 逐条读取 SSE 消息
+type sseStream struct {
+	scanner *bufio.Scanner
+}
+
+func (s *sseStream) ReadJSON(v interface{}) error {
+	for s.scanner.Scan() {
+		if line := s.scanner.Text(); strings.HasPrefix(line, "data: ") {
+			return json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), v)
+		}
+	}
+	return s.scanner.Err()
+}
+
+// pollStream 通过长轮询逐条读取消息
+type pollStream struct {
+	url     string
+	pending []json.RawMessage
+}
+
+func (p *pollStream) ReadJSON(v interface{}) error {
+	for len(p.pending) == 0 {
+		resp, err := http.Get(p.url)
+		if err != nil {
+			return err
+		}
+		err = json.NewDecoder(resp.Body).Decode(&p.pending)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+	message := p.pending[0]
+	p.pending = p.pending[1:]
+	return json.Unmarshal(message, v)
+}
+
+// postMessage 通过 HTTP 传输发送消息
+func postMessage(t *testing.T, url string, conn string, env *websocket.Envelope) {
+	body, _ := json.Marshal(env)
+	resp, err := http.Post(url+"/ws/send?conn="+conn, "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("send status %d", resp.StatusCode)
+	}
+}
+
+// TestHTTPTransports 测试 SSE 与长轮询客户端和 websocket 客户端共享房间
+func TestHTTPTransports(t *testing.T) {
+	server := websocket.NewServer(&websocket.ServerConfig{HTTPTransports: true, PollTimeout: time.Second})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	alice := dialChat(t, ts.URL)
+	defer alice.Close()
+	login(alice, "r", "alice")
+	readUntil(t, alice, websocket.TypeLogin)
+
+	// SSE 下行
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/ws/sse", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	sse := &sseStream{scanner: bufio.NewScanner(resp.Body)}
+	var handshake websocket.HandshakePayload
+	if err := readUntil(t, sse, websocket.TypeHandshake).DecodePayload(&handshake); err != nil || handshake.Conn == "" {
+		t.Fatalf("unexpected handshake %+v", handshake)
+	}
+	env := websocket.NewEnvelope(websocket.TypeLogin, &websocket.LoginPayload{Name: "bob"})
+	env.Room, env.Id = "r", "login-1"
+	postMessage(t, ts.URL, handshake.Conn, env)
+	if event := memberPayload(t, readUntil(t, sse, websocket.TypeLogin)); len(event.UserList) != 2 {
+		t.Fatalf("user list %v, want 2 users", event.UserList)
+	}
+	if ack := readUntil(t, sse, websocket.TypeAck); ack.Id != "login-1" {
+		t.Fatalf("ack %s, want login-1", ack.Id)
+	}
+	if event := memberPayload(t, readUntil(t, alice, websocket.TypeLogin)); event.User != "bob" {
+		t.Fatalf("login of %s, want bob", event.User)
+	}
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "hi bob"})
+	if content := textPayload(t, readUntil(t, sse, websocket.TypeUser)); content != "hi bob" {
+		t.Fatalf("content %q, want %q", content, "hi bob")
+	}
+
+	// 长轮询下行
+	poll := &pollStream{url: ts.URL + "/ws/poll"}
+	if err := readUntil(t, poll, websocket.TypeHandshake).DecodePayload(&handshake); err != nil || handshake.Conn == "" {
+		t.Fatalf("unexpected handshake %+v", handshake)
+	}
+	poll.url += "?conn=" + handshake.Conn
+	env = websocket.NewEnvelope(websocket.TypeUser, &websocket.TextPayload{Content: "hello"})
+	env.Room = "r"
+	postMessage(t, ts.URL, handshake.Conn, env)
+	var nack websocket.NackPayload
+	if err := readUntil(t, poll, websocket.TypeNack).DecodePayload(&nack); err != nil || nack.Code != websocket.CodeNotLoggedIn {
+		t.Fatalf("code %d, want %d", nack.Code, websocket.CodeNotLoggedIn)
+	}
+	env = websocket.NewEnvelope(websocket.TypeLogin, &websocket.LoginPayload{Name: "carol"})
+	env.Room = "r"
+	postMessage(t, ts.URL, handshake.Conn, env)
+	if event := memberPayload(t, readUntil(t, poll, websocket.TypeLogin)); len(event.UserList) != 3 {
+		t.Fatalf("user list %v, want 3 users", event.UserList)
+	}
+	send(alice, websocket.TypeUser, "r", &websocket.TextPayload{Content: "hi carol"})
+	if content := textPayload(t, readUntil(t, poll, websocket.TypeUser)); content != "hi carol" {
+		t.Fatalf("content %q, want %q", content, "hi carol")
+	}
+
+	// SSE 断开后 bob 下线
+	cancel()
+	for {
+		if event := readUntil(t, alice, websocket.TypeLogout); event.From == "bob" {
+			break
+		}
+	}
+}
@@ -0,0 +1,301 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  api
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 5:30 下午
+ */
+
+package websocket
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	// ActionAnnouncement 全局公告
+	ActionAnnouncement = "announcement"
+	defaultAPIPrefix   = "/api"
+	defaultPushFrom    = "system"
+	maxAPIBodySize     = 64 * 1024
+	maxOnlineQuery     = 1000
+)
+
+var ErrUserOffline = errors.New("user offline")
+
+// APIConfig 后端推送接口配置，Token 与 Authorize 至少设置一项，否则所有请求均被拒绝
+type APIConfig struct {
+	Prefix    string                     // 接口路由前缀，默认 /api
+	Token     string                     // 调用方通过 Authorization: Bearer <Token> 携带的密钥
+	Authorize func(r *http.Request) bool // 自定义鉴权，设置后替代 Token 校验
+}
+
+// authorize 校验调用方身份
+func (a *APIConfig) authorize(r *http.Request) bool {
+	if a.Authorize != nil {
+		return a.Authorize(r)
+	}
+	if a.Token == "" {
+		return false
+	}
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return false
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) == 1
+}
+
+// PushMessage 后端推送的消息
+type PushMessage struct {
+	From    string            `json:"from"`    // 发送方名称，默认 system
+	Content string            `json:"content"` // 消息内容
+	Meta    map[string]string `json:"meta"`    // 扩展字段
+}
+
+// BroadcastRoom 以服务端身份向房间广播消息，消息分配序号并保存到聊天记录，返回消息序号
+// 未启用多节点总线时房间必须存在于本节点
+func (s *Server) BroadcastRoom(room string, msg *PushMessage) (int64, error) {
+	if room == "" {
+		return 0, ErrRoomNotFound
+	}
+	h := s.rooms.get(room)
+	if h == nil && s.rooms.backplane != nil {
+		h = s.rooms.getOrCreate(room)
+	}
+	if h == nil {
+		return 0, ErrRoomNotFound
+	}
+	env := s.pushEnvelope(TypeUser, msg)
+	env.Room = room
+	if !h.post(env, func(env *Envelope) { s.record(env, msg.Content, "") }) {
+		return 0, ErrRoomNotFound
+	}
+	return env.Seq, nil
+}
+
+// SendToUser 以服务端身份向用户发送私聊消息，用户在所有节点均不在线时返回 ErrUserOffline
+func (s *Server) SendToUser(user string, msg *PushMessage) error {
+	env := s.pushEnvelope(TypeDirect, msg)
+	env.To = user
+	data_b := env.encode()
+	delivered := s.users.send(user, data_b) > 0
+	if bp := s.rooms.backplane; bp != nil && bp.sendDirect(user, data_b) {
+		delivered = true
+	}
+	if !delivered {
+		return ErrUserOffline
+	}
+	s.record(env, msg.Content, "")
+	return nil
+}
+
+// Announce 向所有节点的所有连接发送全局公告，返回本节点写入的连接数
+func (s *Server) Announce(content string) int {
+	env := NewEnvelope(TypeSystem, &SystemPayload{Action: ActionAnnouncement, Operator: defaultPushFrom, Content: content})
+	data_b := env.encode()
+	if bp := s.rooms.backplane; bp != nil {
+		bp.publishAnnouncement(data_b)
+	}
+	return s.sendAll(data_b)
+}
+
+// Online 查询用户是否在线，启用多节点总线时包含其他节点上的用户
+func (s *Server) Online(users ...string) (map[string]bool, error) {
+	result := make(map[string]bool, len(users))
+	var remote []string
+	for _, user := range users {
+		result[user] = s.users.online(user)
+		if !result[user] {
+			remote = append(remote, user)
+		}
+	}
+	if bp := s.rooms.backplane; bp != nil && len(remote) > 0 {
+		online, err := bp.online(context.Background(), remote)
+		if err != nil {
+			return nil, err
+		}
+		for user, ok := range online {
+			result[user] = ok
+		}
+	}
+	return result, nil
+}
+
+// pushEnvelope 构造服务端推送的消息
+func (s *Server) pushEnvelope(typ string, msg *PushMessage) *Envelope {
+	from := msg.From
+	if from == "" {
+		from = defaultPushFrom
+	}
+	env := NewEnvelope(typ, &TextPayload{Content: msg.Content})
+	env.From, env.Meta = from, msg.Meta
+	return env
+}
+
+// sendAll 向本节点所有连接发送消息，返回成功写入的连接数
+func (s *Server) sendAll(data []byte) int {
+	s.mu.Lock()
+	conns := make([]*connection, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	f := newFrames(data)
+	count := 0
+	for _, c := range conns {
+		message, err := f.get(c.codec)
+		if err != nil {
+			c.logError(err)
+			continue
+		}
+		if c.enqueue(message, f) {
+			count++
+		}
+	}
+	return count
+}
+
+// mountAPI 挂载后端推送接口
+//
+//	POST {prefix}/rooms/{room}/messages  向房间广播消息
+//	POST {prefix}/users/{user}/messages  向用户发送私聊消息
+//	POST {prefix}/announcements          发送全局公告
+//	GET  {prefix}/users/online?user=a&user=b 查询用户在线状态
+//	POST {prefix}/inbox/{uid}/messages   向 uid 发送消息，离线时保存到收件箱
+//	GET  {prefix}/inbox/{uid}/unread     查询 uid 未读消息数
+//	GET  {prefix}/rooms/{room}/transcript?format=csv&start=&end= 导出房间聊天记录
+func (s *Server) mountAPI(router *mux.Router) {
+	prefix := s.config.API.Prefix
+	if prefix == "" {
+		prefix = defaultAPIPrefix
+	}
+	api := router.PathPrefix(prefix).Subrouter()
+	api.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !s.config.API.authorize(r) {
+				writeAPIError(w, http.StatusUnauthorized, &ProtocolError{Code: CodeInvalidToken, Message: "unauthorized"})
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodySize)
+			next.ServeHTTP(w, r)
+		})
+	})
+	api.HandleFunc("/rooms/{room}/messages", s.apiBroadcastRoom).Methods(http.MethodPost)
+	api.HandleFunc("/users/online", s.apiOnline).Methods(http.MethodGet)
+	api.HandleFunc("/users/{user}/messages", s.apiSendToUser).Methods(http.MethodPost)
+	api.HandleFunc("/announcements", s.apiAnnounce).Methods(http.MethodPost)
+	api.HandleFunc("/inbox/{uid:[0-9]+}/messages", s.apiSendToUid).Methods(http.MethodPost)
+	api.HandleFunc("/inbox/{uid:[0-9]+}/unread", s.apiUnread).Methods(http.MethodGet)
+	api.HandleFunc("/rooms/{room}/transcript", s.apiTranscript).Methods(http.MethodGet)
+}
+
+func (s *Server) apiBroadcastRoom(w http.ResponseWriter, r *http.Request) {
+	var msg PushMessage
+	if !readAPIBody(w, r, &msg) {
+		return
+	}
+	seq, err := s.BroadcastRoom(mux.Vars(r)["room"], &msg)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, &ProtocolError{Code: CodeRoomNotFound, Message: err.Error()})
+		return
+	}
+	writeAPIResult(w, map[string]int64{"seq": seq})
+}
+
+func (s *Server) apiSendToUser(w http.ResponseWriter, r *http.Request) {
+	var msg PushMessage
+	if !readAPIBody(w, r, &msg) {
+		return
+	}
+	if err := s.SendToUser(mux.Vars(r)["user"], &msg); err != nil {
+		writeAPIError(w, http.StatusNotFound, &ProtocolError{Code: CodeUserOffline, Message: err.Error()})
+		return
+	}
+	writeAPIResult(w, map[string]bool{"delivered": true})
+}
+
+func (s *Server) apiAnnounce(w http.ResponseWriter, r *http.Request) {
+	var msg PushMessage
+	if !readAPIBody(w, r, &msg) {
+		return
+	}
+	writeAPIResult(w, map[string]int{"connections": s.Announce(msg.Content)})
+}
+
+func (s *Server) apiOnline(w http.ResponseWriter, r *http.Request) {
+	users := r.URL.Query()["user"]
+	if len(users) == 0 || len(users) > maxOnlineQuery {
+		writeAPIError(w, http.StatusBadRequest, &ProtocolError{Code: CodeInvalidPayload, Message: "user required, at most 1000"})
+		return
+	}
+	online, err := s.Online(users...)
+	if err != nil {
+		s.logger.Logger.Error(err.Error(), zap.Strings("users", users))
+		writeAPIError(w, http.StatusInternalServerError, &ProtocolError{Code: CodeInternalError, Message: "internal error"})
+		return
+	}
+	writeAPIResult(w, online)
+}
+
+func (s *Server) apiSendToUid(w http.ResponseWriter, r *http.Request) {
+	var msg PushMessage
+	if !readAPIBody(w, r, &msg) {
+		return
+	}
+	uid, _ := strconv.ParseInt(mux.Vars(r)["uid"], 10, 64)
+	inbox, err := s.SendToUid(uid, &msg)
+	if err != nil {
+		s.writeInboxError(w, err)
+		return
+	}
+	writeAPIResult(w, map[string]int64{"id": inbox.Id})
+}
+
+func (s *Server) apiUnread(w http.ResponseWriter, r *http.Request) {
+	uid, _ := strconv.ParseInt(mux.Vars(r)["uid"], 10, 64)
+	unread, err := s.Unread(uid)
+	if err != nil {
+		s.writeInboxError(w, err)
+		return
+	}
+	writeAPIResult(w, map[string]int64{"unread": unread})
+}
+
+func (s *Server) writeInboxError(w http.ResponseWriter, err error) {
+	if err == ErrInboxDisabled {
+		writeAPIError(w, http.StatusNotImplemented, &ProtocolError{Code: CodeUnknownType, Message: err.Error()})
+		return
+	}
+	s.logger.Logger.Error(err.Error())
+	writeAPIError(w, http.StatusInternalServerError, &ProtocolError{Code: CodeInternalError, Message: "internal error"})
+}
+
+// readAPIBody 解析请求体，失败时写入错误响应并返回 false
+func readAPIBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, &ProtocolError{Code: CodeInvalidPayload, Message: err.Error()})
+		return false
+	}
+	return true
+}
+
+func writeAPIResult(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err *ProtocolError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&NackPayload{Code: err.Code, Message: err.Message})
+}
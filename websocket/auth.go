@@ -0,0 +1,134 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  auth
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 5:10 下午
+ */
+
+package websocket
+
+import (
+	"errors"
+	"go-library/encryption"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// CloseTokenExpired token 过期关闭码
+	CloseTokenExpired = 4001
+	// tokenProtocol 通过 Sec-WebSocket-Protocol 传递 token 时使用的子协议名，格式为 "access_token, <token>"
+	tokenProtocol     = "access_token"
+	defaultQueryParam = "token"
+)
+
+var (
+	ErrTokenMissing      = errors.New("token missing")
+	ErrUserAgentMismatch = errors.New("user agent mismatch")
+	ErrUidMismatch       = errors.New("uid mismatch")
+)
+
+// AuthConfig 握手鉴权配置
+type AuthConfig struct {
+	Jwt        *encryption.Jwt // token 校验对象
+	Required   bool            // 是否必须携带 token，为 false 时允许匿名连接，但携带的 token 必须有效
+	QueryParam string          // token 查询参数名，默认 token
+}
+
+// extractToken 依次从查询参数、Sec-WebSocket-Protocol、Authorization 请求头中获取 token
+func (a *AuthConfig) extractToken(r *http.Request) (token string, fromProtocol bool) {
+	queryParam := a.QueryParam
+	if queryParam == "" {
+		queryParam = defaultQueryParam
+	}
+	if token = r.URL.Query().Get(queryParam); token != "" {
+		return token, false
+	}
+	protocols := websocketProtocols(r)
+	for i, protocol := range protocols {
+		if protocol == tokenProtocol && i+1 < len(protocols) {
+			return protocols[i+1], true
+		}
+	}
+	authorization := r.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer ")), false
+	}
+	return "", false
+}
+
+// authenticate 校验握手请求，未携带 token 且不要求鉴权时返回 nil
+func (a *AuthConfig) authenticate(r *http.Request) (claims *encryption.CustomClaims, fromProtocol bool, err error) {
+	token, fromProtocol := a.extractToken(r)
+	if token == "" {
+		if a.Required {
+			return nil, false, ErrTokenMissing
+		}
+		return nil, false, nil
+	}
+	claims, err = a.verify(token, r.UserAgent())
+	return claims, fromProtocol, err
+}
+
+// verify 校验 token 及其绑定的 UserAgent
+func (a *AuthConfig) verify(token string, userAgent string) (*encryption.CustomClaims, error) {
+	claims, err := a.Jwt.VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserAgent != "" && claims.UserAgent != userAgent {
+		return nil, ErrUserAgentMismatch
+	}
+	return claims, nil
+}
+
+// websocketProtocols 解析请求中的 Sec-WebSocket-Protocol
+func websocketProtocols(r *http.Request) []string {
+	var protocols []string
+	for _, header := range r.Header["Sec-Websocket-Protocol"] {
+		for _, protocol := range strings.Split(header, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+	return protocols
+}
+
+// bindClaims 绑定连接身份，并在 token 过期时关闭连接
+func (c *connection) bindClaims(claims *encryption.CustomClaims) {
+	c.claims = claims
+	c.uid = claims.Uid
+	if claims.ExpiresAt == 0 {
+		return
+	}
+	d := time.Until(time.Unix(claims.ExpiresAt, 0))
+	if c.expire == nil {
+		c.expire = time.AfterFunc(d, func() {
+			c.close(CloseTokenExpired, "token expired")
+		})
+	} else {
+		c.expire.Reset(d)
+	}
+}
+
+// refreshToken 处理客户端的 token 刷新消息，新 token 必须属于同一用户
+func (c *connection) refreshToken(token string) error {
+	if c.claims == nil {
+		return newProtocolError(CodeInvalidToken, ErrTokenMissing.Error())
+	}
+	claims, err := c.server.config.Auth.verify(token, c.userAgent)
+	if err == nil && claims.Uid != c.uid {
+		err = ErrUidMismatch
+	}
+	if err != nil {
+		return newProtocolError(CodeInvalidToken, err.Error())
+	}
+	if c.expire != nil {
+		c.expire.Stop()
+	}
+	c.bindClaims(claims)
+	return nil
+}
@@ -0,0 +1,487 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  backplane
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 3:40 下午
+ */
+
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-library/logger"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBackplanePrefix = "websocket"
+	defaultPresenceTTL     = 30 * time.Second
+	backplaneDedupeSize    = 1024
+)
+
+// BackplaneConfig 多节点消息总线配置
+type BackplaneConfig struct {
+	Prefix      string        // redis key 与频道前缀，默认 websocket
+	NodeId      string        // 节点标识，默认随机生成
+	PresenceTTL time.Duration // 节点在线成员 key 过期时间，节点崩溃后成员在过期后消失，默认 30 秒
+}
+
+// backplaneMessage 节点间传递的消息
+type backplaneMessage struct {
+	Id   string          `json:"id"`            // 消息标识，用于去重
+	Node string          `json:"node"`          // 发送节点
+	Room string          `json:"room"`          // 房间名
+	Seq  int64           `json:"seq,omitempty"` // 房间消息序号
+	Uid  int64           `json:"uid,omitempty"` // 接收用户 uid，为 0 时不是按 uid 发送的消息
+	To   string          `json:"to,omitempty"`  // 私聊接收用户，为空时为房间消息
+	Mod  *moderation     `json:"mod,omitempty"` // 房间管理操作产生的状态变更
+	Data json.RawMessage `json:"data"`          // 消息内容
+}
+
+// Backplane 基于 redis 发布订阅的多节点消息总线，使房间跨越多个服务实例
+type Backplane struct {
+	client      *redis.Client
+	prefix      string
+	nodeId      string
+	presenceTTL time.Duration
+
+	manager  *roomManager
+	users    *userIndex
+	uids     *userIndex
+	announce func(data []byte) int // 向本节点所有连接发送全局公告
+	pubsub   *redis.PubSub
+	logger   *logger.Logger
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	seq      uint64
+
+	mu     sync.Mutex
+	queue  []func()      // 待处理的成员变更，按顺序执行
+	notify chan struct{} // 队列非空通知
+
+	rooms map[string]struct{} // 本节点写入过成员 key 的房间，仅在 work 协程内读写
+
+	recentMu  sync.Mutex
+	recent    map[string]struct{} // 最近收到的消息标识
+	recentIds []string
+}
+
+// NewBackplane 创建多节点消息总线，client 可通过 databases.Redis.NewClient 获取
+func NewBackplane(client *redis.Client, config *BackplaneConfig) *Backplane {
+	if config == nil {
+		config = &BackplaneConfig{}
+	}
+	b := &Backplane{
+		client:      client,
+		prefix:      config.Prefix,
+		nodeId:      config.NodeId,
+		presenceTTL: config.PresenceTTL,
+		notify:      make(chan struct{}, 1),
+		rooms:       make(map[string]struct{}),
+		recent:      make(map[string]struct{}),
+	}
+	if b.prefix == "" {
+		b.prefix = defaultBackplanePrefix
+	}
+	if b.nodeId == "" {
+		b.nodeId = randomId()
+	}
+	if b.presenceTTL <= 0 {
+		b.presenceTTL = defaultPresenceTTL
+	}
+	return b
+}
+
+// NodeId 节点标识
+func (b *Backplane) NodeId() string {
+	return b.nodeId
+}
+
+func (b *Backplane) roomChannel(room string) string {
+	return fmt.Sprintf("%s:room:%s", b.prefix, room)
+}
+
+func (b *Backplane) nodesKey(room string) string {
+	return fmt.Sprintf("%s:nodes:%s", b.prefix, room)
+}
+
+func (b *Backplane) userChannel(user string) string {
+	return fmt.Sprintf("%s:user:%s", b.prefix, user)
+}
+
+func (b *Backplane) announceChannel() string {
+	return fmt.Sprintf("%s:announce", b.prefix)
+}
+
+func (b *Backplane) uidChannel(uid int64) string {
+	return fmt.Sprintf("%s:uid:%d", b.prefix, uid)
+}
+
+func (b *Backplane) membersKey(room string, node string) string {
+	return fmt.Sprintf("%s:members:%s:%s", b.prefix, room, node)
+}
+
+// start 订阅房间频道并启动成员同步协程
+func (b *Backplane) start(manager *roomManager, users *userIndex, uids *userIndex, announce func(data []byte) int, l *logger.Logger) {
+	b.manager = manager
+	b.users = users
+	b.uids = uids
+	b.announce = announce
+	b.logger = l
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+
+	b.pubsub = b.client.PSubscribe(b.ctx, b.roomChannel("*"), fmt.Sprintf("%s:uid:*", b.prefix))
+	if err := b.pubsub.Subscribe(b.ctx, b.announceChannel()); err != nil {
+		l.Logger.Error(err.Error(), zap.String("channel", b.announceChannel()))
+	}
+	b.wg.Add(3)
+	go func() {
+		defer b.wg.Done()
+		defer b.pubsub.Close()
+		b.subscribe(b.pubsub)
+	}()
+	go func() {
+		defer b.wg.Done()
+		b.work()
+	}()
+	go func() {
+		defer b.wg.Done()
+		b.refresh()
+	}()
+}
+
+// stop 停止消息总线并删除本节点的成员 key
+func (b *Backplane) stop() {
+	if b.cancel == nil {
+		return
+	}
+	b.cancel()
+	b.wg.Wait()
+
+	ctx := context.Background()
+	for room := range b.rooms {
+		pipe := b.client.TxPipeline()
+		pipe.Del(ctx, b.membersKey(room, b.nodeId))
+		pipe.ZRem(ctx, b.nodesKey(room), b.nodeId)
+		if _, err := pipe.Exec(ctx); err != nil {
+			b.logger.Logger.Error(err.Error(), zap.String("room", room))
+		}
+	}
+	b.rooms = make(map[string]struct{})
+}
+
+// subscribe 接收其他节点的消息并投递到本地房间
+func (b *Backplane) subscribe(pubsub *redis.PubSub) {
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var m backplaneMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+				b.logger.Logger.Error(err.Error(), zap.String("channel", msg.Channel))
+				continue
+			}
+			if m.Node == b.nodeId || b.seen(m.Id) {
+				continue
+			}
+			if m.Uid != 0 {
+				b.uids.send(uidKey(m.Uid), m.Data)
+			} else if m.To != "" && m.Room != "" {
+				if h := b.manager.get(m.Room); h != nil {
+					h.call(func() { h.sendUser(m.To, m.Data) })
+				}
+			} else if m.To != "" {
+				b.users.send(m.To, m.Data)
+			} else if m.Room == "" {
+				b.announce(m.Data)
+			} else if h := b.manager.get(m.Room); h != nil {
+				if m.Mod != nil {
+					h.call(func() { h.apply(m.Mod, m.Data) })
+				}
+				h.broadcast(m.Seq, m.Data)
+			}
+		}
+	}
+}
+
+// seen 判断消息是否已处理过
+func (b *Backplane) seen(id string) bool {
+	b.recentMu.Lock()
+	defer b.recentMu.Unlock()
+	if _, ok := b.recent[id]; ok {
+		return true
+	}
+	b.recent[id] = struct{}{}
+	b.recentIds = append(b.recentIds, id)
+	if len(b.recentIds) > backplaneDedupeSize {
+		delete(b.recent, b.recentIds[0])
+		b.recentIds = b.recentIds[1:]
+	}
+	return false
+}
+
+// nextId 生成消息标识
+func (b *Backplane) nextId() string {
+	return b.nodeId + ":" + strconv.FormatUint(atomic.AddUint64(&b.seq, 1), 10)
+}
+
+// publish 向其他节点发布房间消息
+func (b *Backplane) publish(room string, seq int64, data []byte) {
+	payload, _ := json.Marshal(&backplaneMessage{Id: b.nextId(), Node: b.nodeId, Room: room, Seq: seq, Data: data})
+	if err := b.client.Publish(b.ctx, b.roomChannel(room), payload).Err(); err != nil {
+		b.logger.Logger.Error(err.Error(), zap.String("room", room), zap.Int64("seq", seq))
+	}
+}
+
+// moderate 向其他节点同步房间管理操作
+func (b *Backplane) moderate(room string, mod *moderation, data []byte) {
+	payload, _ := json.Marshal(&backplaneMessage{Id: b.nextId(), Node: b.nodeId, Room: room, Mod: mod, Data: data})
+	if err := b.client.Publish(b.ctx, b.roomChannel(room), payload).Err(); err != nil {
+		b.logger.Logger.Error(err.Error(), zap.String("room", room))
+	}
+}
+
+// publishAnnouncement 向其他节点发布全局公告
+func (b *Backplane) publishAnnouncement(data []byte) {
+	payload, _ := json.Marshal(&backplaneMessage{Id: b.nextId(), Node: b.nodeId, Data: data})
+	if err := b.client.Publish(b.ctx, b.announceChannel(), payload).Err(); err != nil {
+		b.logger.Logger.Error(err.Error(), zap.String("channel", b.announceChannel()))
+	}
+}
+
+// online 查询用户是否在其他节点在线，用户在线的节点订阅了该用户的频道
+func (b *Backplane) online(ctx context.Context, users []string) (map[string]bool, error) {
+	channels := make([]string, len(users))
+	for i, user := range users {
+		channels[i] = b.userChannel(user)
+	}
+	counts, err := b.client.PubSubNumSub(ctx, channels...).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]bool, len(users))
+	for i, user := range users {
+		result[user] = counts[channels[i]] > 0
+	}
+	return result, nil
+}
+
+// sendUid 向其他节点上的 uid 连接发送消息
+func (b *Backplane) sendUid(uid int64, data []byte) {
+	payload, _ := json.Marshal(&backplaneMessage{Id: b.nextId(), Node: b.nodeId, Uid: uid, Data: data})
+	if err := b.client.Publish(b.ctx, b.uidChannel(uid), payload).Err(); err != nil {
+		b.logger.Logger.Error(err.Error(), zap.Int64("uid", uid))
+	}
+}
+
+// subscribeUser 订阅其他节点发给本节点在线用户的消息
+func (b *Backplane) subscribeUser(user string) {
+	if err := b.pubsub.Subscribe(b.ctx, b.userChannel(user)); err != nil && b.ctx.Err() == nil {
+		b.logger.Logger.Error(err.Error(), zap.String("user", user))
+	}
+}
+
+// unsubscribeUser 用户在本节点下线后取消订阅
+func (b *Backplane) unsubscribeUser(user string) {
+	if err := b.pubsub.Unsubscribe(b.ctx, b.userChannel(user)); err != nil && b.ctx.Err() == nil {
+		b.logger.Logger.Error(err.Error(), zap.String("user", user))
+	}
+}
+
+// sendDirect 向其他节点上的用户发送私聊消息，返回用户是否在其他节点在线
+func (b *Backplane) sendDirect(to string, data []byte) bool {
+	payload, _ := json.Marshal(&backplaneMessage{Id: b.nextId(), Node: b.nodeId, To: to, Data: data})
+	receivers, err := b.client.Publish(b.ctx, b.userChannel(to), payload).Result()
+	if err != nil {
+		b.logger.Logger.Error(err.Error(), zap.String("user", to))
+		return false
+	}
+	// 用户在本节点在线时本节点也是订阅者
+	if b.users.online(to) {
+		receivers--
+	}
+	return receivers > 0
+}
+
+// sendRoomUser 向其他节点上同一房间内的用户发送消息，用户不在该房间内时不发送
+func (b *Backplane) sendRoomUser(room string, to string, data []byte) {
+	payload, _ := json.Marshal(&backplaneMessage{Id: b.nextId(), Node: b.nodeId, Room: room, To: to, Data: data})
+	if err := b.client.Publish(b.ctx, b.userChannel(to), payload).Err(); err != nil {
+		b.logger.Logger.Error(err.Error(), zap.String("room", room), zap.String("user", to))
+	}
+}
+
+// enqueue 追加待处理任务，不会阻塞调用方
+func (b *Backplane) enqueue(f func()) {
+	b.mu.Lock()
+	b.queue = append(b.queue, f)
+	b.mu.Unlock()
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+// work 按顺序处理成员变更
+func (b *Backplane) work() {
+	for {
+		b.mu.Lock()
+		queue := b.queue
+		b.queue = nil
+		b.mu.Unlock()
+		for _, f := range queue {
+			f()
+		}
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-b.notify:
+		}
+	}
+}
+
+// refresh 定期刷新本节点成员 key 的过期时间
+func (b *Backplane) refresh() {
+	ticker := time.NewTicker(b.presenceTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			for _, h := range b.manager.list() {
+				var info RoomInfo
+				if h.call(func() { info = h.info() }) {
+					room, members := info.Name, info.Members
+					b.enqueue(func() { b.savePresence(room, members) })
+				}
+			}
+		}
+	}
+}
+
+// memberChanged 房间成员变更，同步本节点成员并向所有节点广播上下线消息
+func (b *Backplane) memberChanged(room string, env *Envelope, payload *MemberPayload) {
+	localUsers := payload.UserList
+	b.enqueue(func() {
+		b.savePresence(room, localUsers)
+		userList, err := b.members(b.ctx, room)
+		if err != nil {
+			b.logger.Logger.Error(err.Error(), zap.String("room", room))
+			userList = localUsers
+		}
+		payload.UserList = userList
+		env.SetPayload(payload)
+		data_b := env.encode()
+		b.publish(room, 0, data_b)
+		if h := b.manager.get(room); h != nil {
+			h.broadcast(0, data_b)
+		}
+	})
+}
+
+func (b *Backplane) seqKey(room string) string {
+	return fmt.Sprintf("%s:seq:%s", b.prefix, room)
+}
+
+// initSeq 序号 key 不存在时以 last 初始化，用于 redis 数据丢失后从聊天记录的最后序号继续递增
+func (b *Backplane) initSeq(room string, last int64) error {
+	return b.client.SetNX(b.ctx, b.seqKey(room), last, 0).Err()
+}
+
+// nextSeq 分配房间内消息序号
+func (b *Backplane) nextSeq(room string) (int64, error) {
+	return b.client.Incr(b.ctx, b.seqKey(room)).Result()
+}
+
+// savePresence 写入本节点在房间内的成员
+func (b *Backplane) savePresence(room string, users []*RoomUser) {
+	ctx := b.ctx
+	pipe := b.client.TxPipeline()
+	if len(users) == 0 {
+		pipe.Del(ctx, b.membersKey(room, b.nodeId))
+		pipe.ZRem(ctx, b.nodesKey(room), b.nodeId)
+		delete(b.rooms, room)
+	} else {
+		users_b, _ := json.Marshal(users)
+		pipe.Set(ctx, b.membersKey(room, b.nodeId), users_b, b.presenceTTL)
+		pipe.ZAdd(ctx, b.nodesKey(room), &redis.Z{
+			Score:  float64(time.Now().Add(b.presenceTTL).Unix()),
+			Member: b.nodeId,
+		})
+		b.rooms[room] = struct{}{}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && ctx.Err() == nil {
+		b.logger.Logger.Error(err.Error(), zap.String("room", room))
+	}
+}
+
+// members 获取房间在所有节点上的成员，已过期节点的成员被忽略，同一用户在多个节点上的连接数合并计算
+func (b *Backplane) members(ctx context.Context, room string) ([]*RoomUser, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := b.client.ZRemRangeByScore(ctx, b.nodesKey(room), "-inf", "("+now).Err(); err != nil {
+		return nil, err
+	}
+	nodes, err := b.client.ZRange(ctx, b.nodesKey(room), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(nodes)
+	userList := []*RoomUser{}
+	if len(nodes) == 0 {
+		return userList, nil
+	}
+	keys := make([]string, len(nodes))
+	for i, node := range nodes {
+		keys[i] = b.membersKey(room, node)
+	}
+	values, err := b.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]*RoomUser)
+	for _, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var users []*RoomUser
+		if err := json.Unmarshal([]byte(str), &users); err != nil {
+			continue
+		}
+		for _, u := range users {
+			if merged := index[u.key()]; merged != nil {
+				merged.Devices += u.Devices
+				continue
+			}
+			index[u.key()] = u
+			userList = append(userList, u)
+		}
+	}
+	return userList, nil
+}
+
+// randomId 生成随机标识
+func randomId() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,130 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  backpressure
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 9:40 下午
+ */
+
+package websocket
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// CloseSlowConsumer 发送队列溢出关闭码
+	CloseSlowConsumer       = 4008
+	defaultSendQueueSize    = 256
+	defaultCompressionLevel = 1
+)
+
+// SlowConsumerPolicy 连接发送队列已满时的处理方式
+type SlowConsumerPolicy int
+
+const (
+	SlowConsumerDisconnect SlowConsumerPolicy = iota // 以 CloseSlowConsumer 关闭连接并移出房间
+	SlowConsumerDropNewest                           // 丢弃新消息
+	SlowConsumerDropOldest                           // 丢弃队列中最早的消息
+	SlowConsumerCoalesce                             // 用新消息替换队列中同类的正在输入、上下线消息，无可替换的消息时断开连接
+)
+
+// queuedMessage 发送队列中的消息
+type queuedMessage struct {
+	data []byte
+	key  string // 可合并消息的类别，仅在 SlowConsumerCoalesce 策略下设置
+}
+
+// sendQueue 连接发送队列，写协程通过 notify 得知队列非空
+type sendQueue struct {
+	mu     sync.Mutex
+	items  []queuedMessage
+	size   int
+	notify chan struct{}
+}
+
+func newSendQueue(size int) *sendQueue {
+	return &sendQueue{size: size, notify: make(chan struct{}, 1)}
+}
+
+// push 追加消息，队列已满时按 policy 处理，key 为消息的可合并类别，ok 为 false 表示应断开连接，overflow 表示队列已满
+func (q *sendQueue) push(data []byte, key string, policy SlowConsumerPolicy) (ok bool, overflow bool) {
+	item := queuedMessage{data: data, key: key}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) >= q.size {
+		overflow = true
+		switch policy {
+		case SlowConsumerDropNewest:
+			return true, true
+		case SlowConsumerDropOldest:
+			q.items[0] = queuedMessage{}
+			q.items = q.items[1:]
+		case SlowConsumerCoalesce:
+			if !q.coalesce(item.key) {
+				return false, true
+			}
+		default:
+			return false, true
+		}
+	}
+	q.items = append(q.items, item)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return true, overflow
+}
+
+// coalesce 移除队列中类别为 key 的消息
+func (q *sendQueue) coalesce(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, item := range q.items {
+		if item.key == key {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// len 队列中的消息数
+func (q *sendQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// pop 取出最早的消息
+func (q *sendQueue) pop() ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return nil, false
+	}
+	data := q.items[0].data
+	q.items[0] = queuedMessage{}
+	q.items = q.items[1:]
+	return data, true
+}
+
+// coalesceKey 可合并消息的类别，同一发送方的正在输入状态、在线状态与同一房间的上下线消息只需保留最新一条，其他消息返回空
+func coalesceKey(env *Envelope) string {
+	switch env.Type {
+	case TypeTyping:
+		return env.Type + "\x00" + env.Room + "\x00" + env.From + "\x00" + env.To
+	case TypeLogin, TypeLogout:
+		return "member\x00" + env.Room
+	case TypePresence:
+		return env.Type + "\x00" + env.Room + "\x00" + env.From
+	}
+	return ""
+}
+
+// SlowConsumerCount 因发送队列溢出而丢弃、合并消息或断开连接的次数
+func (s *Server) SlowConsumerCount() int64 {
+	return atomic.LoadInt64(&s.slowConsumers)
+}
@@ -0,0 +1,224 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  bot
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 9:10 下午
+ */
+
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBotPrefix = "/"
+	botHelpCommand   = "help"
+)
+
+var ErrCommandFailed = errors.New("command failed")
+
+// BotHandler 机器人命令处理函数，返回错误时记录日志并回复命令执行失败
+type BotHandler func(req *BotRequest) error
+
+// BotConfig 机器人配置
+type BotConfig struct {
+	Name   string   // 机器人名称，作为房间内的用户标识与显示名称
+	Prefix string   // 命令前缀，默认 /
+	Rooms  []string // 加入的房间，为空时加入所有房间
+	Rate   float64  // 每个用户每秒可触发的命令数，为 0 时不限制
+	Burst  int      // 每个用户可连续触发的命令数，默认与 Rate 相同
+}
+
+// Bot 进程内机器人，像普通用户一样出现在房间用户列表中，响应以命令前缀开头的房间消息
+type Bot struct {
+	config  *BotConfig
+	limiter *bucketGroup
+
+	mu       sync.RWMutex
+	commands map[string]*botCommand
+
+	limited int64 // 因限流被忽略的命令数
+}
+
+// botCommand 已注册的命令
+type botCommand struct {
+	description string
+	handler     BotHandler
+}
+
+// BotRequest 机器人收到的命令
+type BotRequest struct {
+	Room    string   // 房间名
+	Uid     int64    // 发送用户 uid
+	From    string   // 发送用户
+	Command string   // 命令名，不含前缀，已转为小写
+	Args    []string // 以空白分隔的命令参数
+	Text    string   // 命令名之后的原始文本
+
+	bot    *Bot
+	server *Server
+}
+
+// NewBot 创建机器人，通过 Handle 注册命令后加入 ServerConfig.Bots
+func NewBot(config *BotConfig) *Bot {
+	if config.Prefix == "" {
+		config.Prefix = defaultBotPrefix
+	}
+	return &Bot{
+		config:   config,
+		limiter:  newBucketGroup(config.Rate, config.Burst),
+		commands: make(map[string]*botCommand),
+	}
+}
+
+// Name 机器人名称
+func (b *Bot) Name() string {
+	return b.config.Name
+}
+
+// Handle 注册命令，command 不含前缀且不区分大小写，description 显示在 help 命令的回复中
+func (b *Bot) Handle(command string, description string, handler BotHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.commands[strings.ToLower(command)] = &botCommand{description: description, handler: handler}
+}
+
+// Limited 因限流被忽略的命令数
+func (b *Bot) Limited() int64 {
+	return atomic.LoadInt64(&b.limited)
+}
+
+// joins 机器人是否加入该房间
+func (b *Bot) joins(room string) bool {
+	if len(b.config.Rooms) == 0 {
+		return true
+	}
+	for _, r := range b.config.Rooms {
+		if r == room {
+			return true
+		}
+	}
+	return false
+}
+
+// parse 解析命令，消息不以前缀开头或通过 @ 指定了其他机器人时返回 nil
+// 多个机器人使用相同前缀时，可以通过 /command@name 指定由哪个机器人处理
+func (b *Bot) parse(content string) *BotRequest {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, b.config.Prefix) {
+		return nil
+	}
+	content = content[len(b.config.Prefix):]
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return nil
+	}
+	command := strings.ToLower(fields[0])
+	if i := strings.Index(command, "@"); i >= 0 {
+		if !strings.EqualFold(command[i+1:], b.config.Name) {
+			return nil
+		}
+		command = command[:i]
+	}
+	text := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(content), fields[0]))
+	return &BotRequest{Command: command, Args: fields[1:], Text: text, bot: b}
+}
+
+// lookup 查找命令处理函数，未注册 help 命令时使用内置的命令列表
+func (b *Bot) lookup(command string) BotHandler {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if cmd := b.commands[command]; cmd != nil {
+		return cmd.handler
+	}
+	if command == botHelpCommand {
+		return b.help
+	}
+	return nil
+}
+
+// help 回复已注册的命令列表
+func (b *Bot) help(req *BotRequest) error {
+	b.mu.RLock()
+	lines := make([]string, 0, len(b.commands))
+	for name, cmd := range b.commands {
+		lines = append(lines, fmt.Sprintf("%s%s %s", b.config.Prefix, name, cmd.description))
+	}
+	b.mu.RUnlock()
+	sort.Strings(lines)
+	return req.Reply(strings.Join(lines, "\n"))
+}
+
+// Reply 以机器人身份向房间回复消息，消息分配序号并保存到聊天记录
+func (req *BotRequest) Reply(content string) error {
+	_, err := req.server.BroadcastRoom(req.Room, &PushMessage{From: req.bot.config.Name, Content: content})
+	return err
+}
+
+// ReplyDirect 以机器人身份向发送用户回复私聊消息
+func (req *BotRequest) ReplyDirect(content string) error {
+	return req.server.SendToUser(req.From, &PushMessage{From: req.bot.config.Name, Content: content})
+}
+
+// addBots 将加入该房间的机器人加入用户列表，机器人没有连接，不影响房间的空闲销毁，仅在创建房间时调用
+func (h *hub) addBots(bots []*Bot) {
+	for _, b := range bots {
+		if !b.joins(h.name) {
+			continue
+		}
+		u := &RoomUser{Id: b.config.Name, Name: b.config.Name, Status: StatusOnline, Bot: true}
+		if _, ok := h.presence[u.key()]; ok {
+			continue
+		}
+		h.presence[u.key()] = u
+		h.order = append(h.order, u.key())
+	}
+}
+
+// dispatchBots 将房间消息交给加入该房间的机器人处理，命令在独立协程中执行，不阻塞发送方的读协程
+func (c *connection) dispatchBots(msg *Envelope, content string) {
+	for _, b := range c.server.config.Bots {
+		if !b.joins(msg.Room) {
+			continue
+		}
+		req := b.parse(content)
+		if req == nil {
+			continue
+		}
+		handler := b.lookup(req.Command)
+		if handler == nil {
+			continue
+		}
+		if !b.limiter.allow(c.presenceKey(), time.Now()) {
+			atomic.AddInt64(&b.limited, 1)
+			continue
+		}
+		req.Room, req.Uid, req.From, req.server = msg.Room, msg.Uid, msg.From, c.server
+		go c.server.runBot(req, handler)
+	}
+}
+
+// runBot 执行命令，处理函数返回错误或 panic 时记录日志并回复命令执行失败
+func (s *Server) runBot(req *BotRequest, handler BotHandler) {
+	fields := []zap.Field{zap.String("bot", req.bot.config.Name), zap.String("command", req.Command), zap.String("room", req.Room), zap.String("user", req.From)}
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Logger.Error("bot panic", append(fields, zap.Any("panic", r))...)
+			_ = req.Reply(ErrCommandFailed.Error())
+		}
+	}()
+	if err := handler(req); err != nil {
+		s.logger.Logger.Error("bot command failed", append(fields, zap.Error(err))...)
+		_ = req.Reply(ErrCommandFailed.Error())
+	}
+}
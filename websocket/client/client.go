@@ -0,0 +1,607 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  client
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 2:10 下午
+ */
+
+package client
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	chat "go-library/websocket"
+)
+
+var (
+	ErrClosed       = errors.New("client closed")
+	ErrDisconnected = errors.New("connection lost before acknowledgement")
+	ErrTimeout      = errors.New("acknowledgement timeout")
+	ErrHandshake    = errors.New("unexpected handshake message")
+	ErrCodec        = errors.New("codec not accepted by server")
+)
+
+const (
+	defaultReconnectMin = 500 * time.Millisecond
+	defaultReconnectMax = 30 * time.Second
+	defaultAckTimeout   = 10 * time.Second
+)
+
+// Config 客户端配置
+type Config struct {
+	Url          string            // 服务地址，如 ws://127.0.0.1:8080/ws
+	Room         string            // 登录的房间，为空时只建立连接不登录
+	Name         string            // 用户名，鉴权连接由服务端使用 uid
+	Password     string            // 房间密码
+	Token        string            // 鉴权 token，通过 Authorization 请求头发送
+	Header       http.Header       // 额外的握手请求头
+	Dialer       *websocket.Dialer // 拨号器，默认 websocket.DefaultDialer
+	NoReconnect  bool              // 是否禁用断线重连
+	ReconnectMin time.Duration     // 重连最小间隔，默认 500 毫秒，每次失败后翻倍
+	ReconnectMax time.Duration     // 重连最大间隔，默认 30 秒
+	AckTimeout   time.Duration     // 等待服务端确认的超时时间，默认 10 秒
+	Codec        chat.Codec        // 消息编码，通过 Sec-WebSocket-Protocol 协商，默认 JSON
+}
+
+// Message 房间消息或私聊消息
+type Message struct {
+	Seq     int64     // 房间内消息序号，私聊消息为 0
+	Room    string    // 房间名
+	Uid     int64     // 发送用户 uid
+	From    string    // 发送用户
+	To      string    // 私聊接收用户
+	Content string    // 消息内容
+	Time    time.Time // 服务端时间
+}
+
+// UserEvent 房间用户列表变化
+type UserEvent struct {
+	Type  string           // login、logout、presence，或会话恢复后的 resume
+	User  string           // 上下线或在线状态变化的用户
+	Users []*chat.RoomUser // 房间当前用户列表
+}
+
+// Client websocket 聊天客户端，断线后自动重连并恢复会话
+type Client struct {
+	config *Config
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	conn     *websocket.Conn
+	lost     chan struct{} // 当前连接断开信号
+	pending  map[string]chan *chat.Envelope
+	handlers map[string]map[int]func(env *chat.Envelope)
+	states   map[int]func(connected bool) // 连接状态变化回调
+	nextId   int
+	users    []*chat.RoomUser
+	session  string
+	uid      int64
+	closed   bool
+
+	lastSeq int64 // 已收到的最后一条房间消息序号
+	idSeq   uint64
+
+	queueMu sync.Mutex
+	queue   []event // 待分发的消息与连接状态变化，按顺序执行订阅回调
+	notify  chan struct{}
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Dial 连接服务并登录房间，连接建立后自动处理断线重连
+func Dial(config *Config) (*Client, error) {
+	if config.Dialer == nil {
+		config.Dialer = websocket.DefaultDialer
+	}
+	if config.ReconnectMin <= 0 {
+		config.ReconnectMin = defaultReconnectMin
+	}
+	if config.ReconnectMax < config.ReconnectMin {
+		config.ReconnectMax = defaultReconnectMax
+	}
+	if config.AckTimeout <= 0 {
+		config.AckTimeout = defaultAckTimeout
+	}
+	c := &Client{
+		config:   config,
+		pending:  make(map[string]chan *chat.Envelope),
+		handlers: make(map[string]map[int]func(env *chat.Envelope)),
+		states:   make(map[int]func(connected bool)),
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	go c.dispatch()
+	c.wg.Add(1)
+	go c.run()
+	return c, nil
+}
+
+// connect 建立连接、读取握手消息，并恢复会话或登录房间
+func (c *Client) connect() error {
+	header := http.Header{}
+	for k, v := range c.config.Header {
+		header[k] = v
+	}
+	if c.config.Token != "" {
+		header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+	if c.config.Codec != nil {
+		header.Set("Sec-WebSocket-Protocol", c.config.Codec.Name())
+	}
+	conn, _, err := c.config.Dialer.Dial(c.config.Url, header)
+	if err != nil {
+		return err
+	}
+	if c.config.Codec != nil && conn.Subprotocol() != c.config.Codec.Name() {
+		conn.Close()
+		return ErrCodec
+	}
+	handshake := &chat.Envelope{}
+	_ = conn.SetReadDeadline(time.Now().Add(c.config.AckTimeout))
+	if err := c.readEnvelope(conn, handshake); err != nil {
+		conn.Close()
+		return err
+	}
+	var payload chat.HandshakePayload
+	if handshake.Type != chat.TypeHandshake || handshake.DecodePayload(&payload) != nil {
+		conn.Close()
+		return ErrHandshake
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	lost := make(chan struct{})
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		conn.Close()
+		return ErrClosed
+	}
+	session := c.session
+	c.conn, c.lost, c.uid = conn, lost, payload.Uid
+	c.mu.Unlock()
+	go c.read(conn, lost)
+
+	if c.config.Room == "" {
+		c.setSession(payload.Session)
+		return nil
+	}
+	// 优先恢复原会话，失败时重新登录并补发聊天记录
+	if session != "" {
+		_, err := c.request(chat.TypeResume, "", &chat.ResumePayload{Session: session, Seq: atomic.LoadInt64(&c.lastSeq)})
+		if err == nil {
+			return nil
+		}
+	}
+	c.setSession(payload.Session)
+	login := &chat.LoginPayload{Name: c.config.Name, Seq: atomic.LoadInt64(&c.lastSeq), Password: c.config.Password}
+	if _, err := c.request(chat.TypeLogin, "", login); err != nil {
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+func (c *Client) setSession(session string) {
+	c.mu.Lock()
+	c.session = session
+	c.mu.Unlock()
+}
+
+// run 连接断开后按指数退避重连
+func (c *Client) run() {
+	defer c.wg.Done()
+	for {
+		c.mu.Lock()
+		lost := c.lost
+		c.mu.Unlock()
+		select {
+		case <-lost:
+		case <-c.done:
+			return
+		}
+		c.emitState(false)
+		if c.config.NoReconnect {
+			c.close()
+			return
+		}
+		backoff := c.config.ReconnectMin
+		for {
+			// 在 [backoff/2, backoff) 内随机等待，避免大量客户端同时重连
+			wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+			select {
+			case <-time.After(wait):
+			case <-c.done:
+				return
+			}
+			if err := c.connect(); err == nil {
+				break
+			} else if err == ErrClosed {
+				return
+			}
+			if backoff *= 2; backoff > c.config.ReconnectMax {
+				backoff = c.config.ReconnectMax
+			}
+		}
+		c.emitState(true)
+	}
+}
+
+// read 读取服务端消息，确认消息交给等待中的请求，其余消息交给订阅回调
+func (c *Client) read(conn *websocket.Conn, lost chan struct{}) {
+	defer func() {
+		conn.Close()
+		c.mu.Lock()
+		for id, ch := range c.pending {
+			ch <- nil
+			delete(c.pending, id)
+		}
+		c.mu.Unlock()
+		close(lost)
+	}()
+	for {
+		env := &chat.Envelope{}
+		if err := c.readEnvelope(conn, env); err != nil {
+			return
+		}
+		switch env.Type {
+		case chat.TypeAck, chat.TypeNack:
+			if env.Id != "" {
+				c.mu.Lock()
+				ch := c.pending[env.Id]
+				delete(c.pending, env.Id)
+				c.mu.Unlock()
+				if ch != nil {
+					ch <- env
+					continue
+				}
+			}
+		case chat.TypeUser:
+			for {
+				last := atomic.LoadInt64(&c.lastSeq)
+				if env.Seq <= last || atomic.CompareAndSwapInt64(&c.lastSeq, last, env.Seq) {
+					break
+				}
+			}
+		case chat.TypeLogin, chat.TypeLogout, chat.TypeResume:
+			var payload chat.MemberPayload
+			if env.DecodePayload(&payload) == nil {
+				c.mu.Lock()
+				c.users = payload.UserList
+				c.mu.Unlock()
+			}
+		case chat.TypePresence:
+			var user chat.RoomUser
+			if env.DecodePayload(&user) == nil {
+				c.mu.Lock()
+				for i, u := range c.users {
+					if u.Id == user.Id {
+						c.users[i] = &user
+					}
+				}
+				c.mu.Unlock()
+			}
+		}
+		c.enqueue(env)
+	}
+}
+
+// request 发送消息并等待服务端确认，处理失败时返回 *chat.ProtocolError
+func (c *Client) request(typ string, to string, payload interface{}) (*chat.Envelope, error) {
+	env := chat.NewEnvelope(typ, payload)
+	env.Id = strconv.FormatUint(atomic.AddUint64(&c.idSeq, 1), 10)
+	env.Room, env.To = c.config.Room, to
+	ch := make(chan *chat.Envelope, 1)
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	conn := c.conn
+	c.pending[env.Id] = ch
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	_ = conn.SetWriteDeadline(time.Now().Add(c.config.AckTimeout))
+	err := c.writeEnvelope(conn, env)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, env.Id)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	timer := time.NewTimer(c.config.AckTimeout)
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		if resp == nil {
+			return nil, ErrDisconnected
+		}
+		if resp.Type == chat.TypeNack {
+			var nack chat.NackPayload
+			_ = resp.DecodePayload(&nack)
+			return nil, &chat.ProtocolError{Code: nack.Code, Message: nack.Message}
+		}
+		return resp, nil
+	case <-timer.C:
+		c.mu.Lock()
+		delete(c.pending, env.Id)
+		c.mu.Unlock()
+		return nil, ErrTimeout
+	case <-c.done:
+		return nil, ErrClosed
+	}
+}
+
+// Request 发送任意类型的消息并等待服务端确认，用于房间管理等扩展消息
+func (c *Client) Request(typ string, payload interface{}) (*chat.Envelope, error) {
+	return c.request(typ, "", payload)
+}
+
+// Send 发送房间消息，返回服务端分配的消息序号
+func (c *Client) Send(content string) (int64, error) {
+	ack, err := c.request(chat.TypeUser, "", &chat.TextPayload{Content: content})
+	if err != nil {
+		return 0, err
+	}
+	return ack.Seq, nil
+}
+
+// SetStatus 设置在线状态，status 为 chat.StatusOnline、chat.StatusAway 或 chat.StatusBusy
+func (c *Client) SetStatus(status string) error {
+	_, err := c.request(chat.TypePresence, "", &chat.PresencePayload{Status: status})
+	return err
+}
+
+// SendDirect 发送私聊消息
+func (c *Client) SendDirect(to string, content string) error {
+	_, err := c.request(chat.TypeDirect, to, &chat.TextPayload{Content: content})
+	return err
+}
+
+// Subscribe 订阅指定类型的消息，回调按消息到达顺序在同一协程内执行，返回取消订阅函数
+func (c *Client) Subscribe(typ string, handler func(env *chat.Envelope)) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextId++
+	id := c.nextId
+	if c.handlers[typ] == nil {
+		c.handlers[typ] = make(map[int]func(env *chat.Envelope))
+	}
+	c.handlers[typ][id] = handler
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.handlers[typ], id)
+	}
+}
+
+// SubscribeRoom 订阅房间消息
+func (c *Client) SubscribeRoom(handler func(msg *Message)) func() {
+	return c.Subscribe(chat.TypeUser, func(env *chat.Envelope) { handler(newMessage(env)) })
+}
+
+// SubscribeDirect 订阅私聊消息
+func (c *Client) SubscribeDirect(handler func(msg *Message)) func() {
+	return c.Subscribe(chat.TypeDirect, func(env *chat.Envelope) { handler(newMessage(env)) })
+}
+
+// SubscribeSystem 订阅系统消息
+func (c *Client) SubscribeSystem(handler func(payload *chat.SystemPayload)) func() {
+	return c.Subscribe(chat.TypeSystem, func(env *chat.Envelope) {
+		payload := &chat.SystemPayload{}
+		if env.DecodePayload(payload) == nil {
+			handler(payload)
+		}
+	})
+}
+
+// SubscribeUsers 订阅房间用户列表变化，包括用户的在线状态变化
+func (c *Client) SubscribeUsers(handler func(event *UserEvent)) func() {
+	f := func(env *chat.Envelope) {
+		var payload chat.MemberPayload
+		if env.DecodePayload(&payload) == nil {
+			handler(&UserEvent{Type: env.Type, User: payload.User, Users: payload.UserList})
+		}
+	}
+	unsubscribes := []func(){
+		c.Subscribe(chat.TypeLogin, f),
+		c.Subscribe(chat.TypeLogout, f),
+		c.Subscribe(chat.TypeResume, f),
+		c.Subscribe(chat.TypePresence, func(env *chat.Envelope) {
+			handler(&UserEvent{Type: env.Type, User: env.From, Users: c.Users()})
+		}),
+	}
+	return func() {
+		for _, unsubscribe := range unsubscribes {
+			unsubscribe()
+		}
+	}
+}
+
+// SubscribeState 订阅连接状态变化，断线时 connected 为 false，重连成功后为 true
+func (c *Client) SubscribeState(handler func(connected bool)) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextId++
+	id := c.nextId
+	c.states[id] = handler
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.states, id)
+	}
+}
+
+// Users 房间当前用户列表
+func (c *Client) Users() []*chat.RoomUser {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	users := make([]*chat.RoomUser, len(c.users))
+	for i, u := range c.users {
+		user := *u
+		users[i] = &user
+	}
+	return users
+}
+
+// Uid 鉴权连接的用户 uid，匿名连接为 0
+func (c *Client) Uid() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.uid
+}
+
+// LastSeq 已收到的最后一条房间消息序号
+func (c *Client) LastSeq() int64 {
+	return atomic.LoadInt64(&c.lastSeq)
+}
+
+// Close 关闭客户端，不再重连
+func (c *Client) Close() error {
+	err := c.close()
+	c.wg.Wait()
+	return err
+}
+
+// close 关闭当前连接并停止重连
+func (c *Client) close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	conn := c.conn
+	close(c.done)
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	_ = conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	return conn.Close()
+}
+
+// event 分发队列中的事件
+type event struct {
+	env       *chat.Envelope // 服务端消息，连接状态变化时为空
+	connected bool           // 连接状态，env 为空时有效
+}
+
+// emitState 分发连接状态变化
+func (c *Client) emitState(connected bool) {
+	c.push(event{connected: connected})
+}
+
+// enqueue 将消息加入分发队列，不阻塞读协程
+func (c *Client) enqueue(env *chat.Envelope) {
+	c.push(event{env: env})
+}
+
+// push 将事件加入分发队列并唤醒分发协程
+func (c *Client) push(ev event) {
+	c.queueMu.Lock()
+	c.queue = append(c.queue, ev)
+	c.queueMu.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch 按顺序执行订阅回调，回调中可以调用 Send 等待确认
+func (c *Client) dispatch() {
+	for {
+		select {
+		case <-c.notify:
+		case <-c.done:
+			return
+		}
+		for {
+			c.queueMu.Lock()
+			if len(c.queue) == 0 {
+				c.queueMu.Unlock()
+				break
+			}
+			ev := c.queue[0]
+			c.queue = c.queue[1:]
+			c.queueMu.Unlock()
+
+			if ev.env == nil {
+				c.mu.Lock()
+				states := make([]func(connected bool), 0, len(c.states))
+				for _, handler := range c.states {
+					states = append(states, handler)
+				}
+				c.mu.Unlock()
+				for _, handler := range states {
+					handler(ev.connected)
+				}
+				continue
+			}
+			c.mu.Lock()
+			handlers := make([]func(env *chat.Envelope), 0, len(c.handlers[ev.env.Type]))
+			for _, handler := range c.handlers[ev.env.Type] {
+				handlers = append(handlers, handler)
+			}
+			c.mu.Unlock()
+			for _, handler := range handlers {
+				handler(ev.env)
+			}
+		}
+	}
+}
+
+func newMessage(env *chat.Envelope) *Message {
+	var payload chat.TextPayload
+	_ = env.DecodePayload(&payload)
+	return &Message{
+		Seq:     env.Seq,
+		Room:    env.Room,
+		Uid:     env.Uid,
+		From:    env.From,
+		To:      env.To,
+		Content: payload.Content,
+		Time:    time.UnixMilli(env.Ts),
+	}
+}
+
+// readEnvelope 读取并解码一条消息
+func (c *Client) readEnvelope(conn *websocket.Conn, env *chat.Envelope) error {
+	if c.config.Codec == nil {
+		return conn.ReadJSON(env)
+	}
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return c.config.Codec.Unmarshal(data, env)
+}
+
+// writeEnvelope 编码并发送一条消息
+func (c *Client) writeEnvelope(conn *websocket.Conn, env *chat.Envelope) error {
+	if c.config.Codec == nil {
+		return conn.WriteJSON(env)
+	}
+	data, err := c.config.Codec.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(c.config.Codec.MessageType(), data)
+}
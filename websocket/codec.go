@@ -0,0 +1,364 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  codec
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 9:20 上午
+ */
+
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 编码方式对应的子协议名
+const (
+	ProtocolJSON     = "json"
+	ProtocolMsgpack  = "msgpack"
+	ProtocolProtobuf = "protobuf"
+)
+
+var ErrMalformedProtobuf = errors.New("malformed protobuf envelope")
+
+// Codec 消息编码方式，客户端在 Sec-WebSocket-Protocol 中按优先级列出子协议名，服务端选择第一个支持的编码
+type Codec interface {
+	// Name 子协议名
+	Name() string
+	// MessageType websocket 帧类型，websocket.TextMessage 或 websocket.BinaryMessage
+	MessageType() int
+	// Marshal 编码消息
+	Marshal(env *Envelope) ([]byte, error)
+	// Unmarshal 解码消息
+	Unmarshal(data []byte, env *Envelope) error
+}
+
+// defaultCodec 默认编码，未协商子协议的连接与 HTTP 传输使用 JSON
+var defaultCodec Codec = JSONCodec{}
+
+// JSONCodec JSON 文本编码
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string { return ProtocolJSON }
+
+func (JSONCodec) MessageType() int { return websocket.TextMessage }
+
+func (JSONCodec) Marshal(env *Envelope) ([]byte, error) {
+	return json.Marshal(env)
+}
+
+func (JSONCodec) Unmarshal(data []byte, env *Envelope) error {
+	return json.Unmarshal(data, env)
+}
+
+// MsgpackCodec MessagePack 二进制编码，字段名与 JSON 编码相同，消息内容编码为 MessagePack 对象
+type MsgpackCodec struct{}
+
+// msgpackEnvelope MessagePack 编码的消息信封
+type msgpackEnvelope struct {
+	V       int               `msgpack:"v"`
+	Id      string            `msgpack:"id,omitempty"`
+	Seq     int64             `msgpack:"seq,omitempty"`
+	Ts      int64             `msgpack:"ts,omitempty"`
+	Type    string            `msgpack:"type"`
+	Room    string            `msgpack:"room,omitempty"`
+	Uid     int64             `msgpack:"uid,omitempty"`
+	From    string            `msgpack:"from,omitempty"`
+	To      string            `msgpack:"to,omitempty"`
+	Payload interface{}       `msgpack:"payload,omitempty"`
+	Meta    map[string]string `msgpack:"meta,omitempty"`
+}
+
+func (MsgpackCodec) Name() string { return ProtocolMsgpack }
+
+func (MsgpackCodec) MessageType() int { return websocket.BinaryMessage }
+
+func (MsgpackCodec) Marshal(env *Envelope) ([]byte, error) {
+	msg := &msgpackEnvelope{
+		V: env.V, Id: env.Id, Seq: env.Seq, Ts: env.Ts, Type: env.Type, Room: env.Room,
+		Uid: env.Uid, From: env.From, To: env.To, Meta: env.Meta,
+	}
+	if len(env.Payload) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(env.Payload))
+		decoder.UseNumber()
+		var payload interface{}
+		if err := decoder.Decode(&payload); err != nil {
+			return nil, err
+		}
+		msg.Payload = jsonNumbers(payload)
+	}
+	return msgpack.Marshal(msg)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, env *Envelope) error {
+	var msg msgpackEnvelope
+	if err := msgpack.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	*env = Envelope{
+		V: msg.V, Id: msg.Id, Seq: msg.Seq, Ts: msg.Ts, Type: msg.Type, Room: msg.Room,
+		Uid: msg.Uid, From: msg.From, To: msg.To, Meta: msg.Meta,
+	}
+	if msg.Payload != nil {
+		payload_b, err := json.Marshal(msg.Payload)
+		if err != nil {
+			return err
+		}
+		env.Payload = payload_b
+	}
+	return nil
+}
+
+// jsonNumbers 将 json.Number 转换为整数或浮点数，使整数以 MessagePack 整数编码
+func jsonNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = jsonNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = jsonNumbers(item)
+		}
+	}
+	return v
+}
+
+// ProtobufCodec Protocol Buffers 二进制编码，消息内容保持 JSON 编码，对应的定义为
+//
+//	message Envelope {
+//	  int32  v       = 1;
+//	  string id      = 2;
+//	  int64  seq     = 3;
+//	  int64  ts      = 4;
+//	  string type    = 5;
+//	  string room    = 6;
+//	  int64  uid     = 7;
+//	  string from    = 8;
+//	  string to      = 9;
+//	  bytes  payload = 10; // JSON 编码的消息内容
+//	  map<string, string> meta = 11;
+//	}
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Name() string { return ProtocolProtobuf }
+
+func (ProtobufCodec) MessageType() int { return websocket.BinaryMessage }
+
+func (ProtobufCodec) Marshal(env *Envelope) ([]byte, error) {
+	var b []byte
+	appendVarint := func(num protowire.Number, v int64) {
+		if v != 0 {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(v))
+		}
+	}
+	appendString := func(num protowire.Number, v string) {
+		if v != "" {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, v)
+		}
+	}
+	appendVarint(1, int64(env.V))
+	appendString(2, env.Id)
+	appendVarint(3, env.Seq)
+	appendVarint(4, env.Ts)
+	appendString(5, env.Type)
+	appendString(6, env.Room)
+	appendVarint(7, env.Uid)
+	appendString(8, env.From)
+	appendString(9, env.To)
+	if len(env.Payload) > 0 {
+		b = protowire.AppendTag(b, 10, protowire.BytesType)
+		b = protowire.AppendBytes(b, env.Payload)
+	}
+	keys := make([]string, 0, len(env.Meta))
+	for k := range env.Meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, env.Meta[k])
+		b = protowire.AppendTag(b, 11, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b, nil
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, env *Envelope) error {
+	*env = Envelope{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return ErrMalformedProtobuf
+		}
+		data = data[n:]
+		var (
+			varint  uint64
+			field_b []byte
+		)
+		switch {
+		case typ == protowire.VarintType && (num == 1 || num == 3 || num == 4 || num == 7):
+			varint, n = protowire.ConsumeVarint(data)
+		case typ == protowire.BytesType && num >= 2 && num <= 11 && num != 3 && num != 4 && num != 7:
+			field_b, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return ErrMalformedProtobuf
+		}
+		data = data[n:]
+		switch num {
+		case 1:
+			env.V = int(int32(varint))
+		case 2:
+			env.Id = string(field_b)
+		case 3:
+			env.Seq = int64(varint)
+		case 4:
+			env.Ts = int64(varint)
+		case 5:
+			env.Type = string(field_b)
+		case 6:
+			env.Room = string(field_b)
+		case 7:
+			env.Uid = int64(varint)
+		case 8:
+			env.From = string(field_b)
+		case 9:
+			env.To = string(field_b)
+		case 10:
+			if field_b != nil {
+				env.Payload = append(json.RawMessage(nil), field_b...)
+			}
+		case 11:
+			if field_b == nil {
+				continue
+			}
+			key, value, err := consumeMapEntry(field_b)
+			if err != nil {
+				return err
+			}
+			if env.Meta == nil {
+				env.Meta = make(map[string]string)
+			}
+			env.Meta[key] = value
+		}
+	}
+	return nil
+}
+
+// consumeMapEntry 解析 map<string, string> 的一个键值对
+func consumeMapEntry(data []byte) (key string, value string, err error) {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return "", "", ErrMalformedProtobuf
+		}
+		data = data[n:]
+		if typ != protowire.BytesType || (num != 1 && num != 2) {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return "", "", ErrMalformedProtobuf
+			}
+			data = data[n:]
+			continue
+		}
+		v, n := protowire.ConsumeString(data)
+		if n < 0 {
+			return "", "", ErrMalformedProtobuf
+		}
+		data = data[n:]
+		if num == 1 {
+			key = v
+		} else {
+			value = v
+		}
+	}
+	return key, value, nil
+}
+
+// negotiate 按客户端在 Sec-WebSocket-Protocol 中列出的顺序选择编码，没有支持的编码时返回 nil
+func (s *Server) negotiate(r *http.Request) Codec {
+	for _, protocol := range websocketProtocols(r) {
+		if codec, ok := s.codecs[protocol]; ok {
+			return codec
+		}
+	}
+	return nil
+}
+
+// transcode 将 JSON 编码的消息转换为 codec 编码
+func transcode(codec Codec, data []byte) ([]byte, error) {
+	if codec.Name() == ProtocolJSON {
+		return data, nil
+	}
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	return codec.Marshal(&env)
+}
+
+// frames 一次广播在各编码下的消息，每种编码只编码一次
+type frames struct {
+	data    []byte            // JSON 编码的消息
+	encoded map[string][]byte // 按子协议名缓存的编码结果
+	key     string            // 可合并消息的类别
+	keyed   bool              // 是否已解析 key
+}
+
+func newFrames(data []byte) *frames {
+	return &frames{data: data}
+}
+
+// get 获取 codec 编码的消息
+func (f *frames) get(codec Codec) ([]byte, error) {
+	name := codec.Name()
+	if name == ProtocolJSON {
+		return f.data, nil
+	}
+	if message, ok := f.encoded[name]; ok {
+		return message, nil
+	}
+	message, err := transcode(codec, f.data)
+	if err != nil {
+		return nil, err
+	}
+	if f.encoded == nil {
+		f.encoded = make(map[string][]byte)
+	}
+	f.encoded[name] = message
+	return message, nil
+}
+
+// coalesceKey 可合并消息的类别，一次广播只解析一次
+func (f *frames) coalesceKey() string {
+	if !f.keyed {
+		var env Envelope
+		if err := json.Unmarshal(f.data, &env); err == nil {
+			f.key = coalesceKey(&env)
+		}
+		f.keyed = true
+	}
+	return f.key
+}
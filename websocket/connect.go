@@ -9,141 +9,635 @@
 package websocket
 
 import (
-	"encoding/json"
 	"fmt"
+	"go-library/encryption"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
 )
 
-type Data struct {
-	Ip       string   `json:"ip"`
-	Room     string   `json:"room"`
-	User     string   `json:"user"`
-	From     string   `json:"from"`
-	Type     string   `json:"type"`
-	Content  string   `json:"content"`
-	UserList []string `json:"user_list"`
-}
+// closeWriteWait 发送关闭帧的超时时间
+const closeWriteWait = time.Second
+
+// ackCacheSize 每个连接缓存的已确认消息数量，用于识别客户端重试
+const ackCacheSize = 256
 
 type connection struct {
-	ws   *websocket.Conn
-	sc   chan []byte
-	data *Data
+	ws     *websocket.Conn // websocket 连接，HTTP 传输为空
+	queue  *sendQueue
+	server *Server
+	codec  Codec        // 协商的消息编码，发送队列中的消息均为该编码
+	since  time.Time    // 连接建立时间
+	id     string       // HTTP 传输的连接标识，客户端发送消息与轮询时携带
+	http   *httpChannel // HTTP 传输状态，websocket 连接为空
+
+	// 以下字段由读协程维护，加入房间后在房间协程内只读
+	ip        string
+	userAgent string
+	room      string
+	uid       int64
+	user      string // 用户标识，鉴权连接为 uid
+	name      string // 显示名称
+	hub       *hub
+
+	claims   *encryption.CustomClaims // 握手鉴权得到的 token 信息，匿名连接为空
+	expire   *time.Timer              // token 过期计时
+	session  *session                 // 可恢复的会话，未启用会话恢复时为空
+	limiter  *connLimiter             // 连接级限流状态，未启用限流时为空
+	limitIp  string                   // 占用连接数配额的地址，未启用限流时为空
+	hookConn *Conn                    // 提供给钩子的连接句柄
+
+	inboxDelivered bool                  // 是否已下发收件箱未读消息
+	sent           map[sentKey]time.Time // 最近发送的房间消息，用于撤回校验，仅在读协程内读写
+	sentKeys       []sentKey
+	typingState    bool      // 最后转发的正在输入状态
+	typingAt       time.Time // 最后转发正在输入状态的时间
+
+	holding bool          // 是否正在补发聊天记录，期间的房间消息暂存到 pending，仅在房间协程内读写
+	pending []roomMessage // 补发聊天记录期间暂存的房间消息
+
+	acks   map[string][]byte // 已确认的客户端消息标识及其 ack，仅在读协程内读写
+	ackIds []string
+
+	done      chan struct{} // 关闭信号
+	closeOnce sync.Once
+	closeCode int    // 关闭帧状态码
+	closeText string // 关闭帧原因
 }
 
-var wu = &websocket.Upgrader{ReadBufferSize: 512,
-	WriteBufferSize: 512, CheckOrigin: func(r *http.Request) bool { return true }}
+func newConnection(s *Server, r *http.Request) *connection {
+	c := &connection{
+		queue:     newSendQueue(s.config.SendQueueSize),
+		server:    s,
+		codec:     defaultCodec,
+		since:     time.Now(),
+		ip:        s.clientIP(r),
+		userAgent: r.UserAgent(),
+		acks:      make(map[string][]byte),
+		done:      make(chan struct{}),
+	}
+	c.hookConn = &Conn{c: c}
+	return c
+}
 
-func myws(w http.ResponseWriter, r *http.Request) {
-	ws, err := wu.Upgrade(w, r, nil)
+// ServeHTTP 升级 websocket 连接并处理消息
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, responseHeader := s.open(w, r)
+	if c == nil {
+		return
+	}
+	// 选中的编码子协议优先于 access_token 返回给客户端
+	if codec := s.negotiate(r); codec != nil {
+		c.codec = codec
+		responseHeader = http.Header{"Sec-Websocket-Protocol": {codec.Name()}}
+	}
+	ws, err := s.upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
+		c.release()
 		return
 	}
-	c := &connection{sc: make(chan []byte, 256), ws: ws, data: &Data{}}
-	rChan <- c
-
-	go c.writer()
-	c.reader()
-	defer func() {
-		h := hubMap[c.data.Room]
-		if h != nil {
-			c.data.Type = "logout"
-			h.userList = del(h.userList, c.data.User)
-			c.data.UserList = h.userList
-			c.data.Content = c.data.User
-			data_b, _ := json.Marshal(c.data)
-			h.b <- data_b
-			rChan <- c
-			h.u <- c
+	c.ws = ws
+	if s.config.EnableCompression {
+		ws.EnableWriteCompression(true)
+		if err := ws.SetCompressionLevel(s.config.CompressionLevel); err != nil {
+			s.logger.Logger.Error(err.Error(), zap.Int("level", s.config.CompressionLevel))
 		}
+	}
+	if !s.addConn(c) {
+		c.close(websocket.CloseGoingAway, "server shutdown")
+		c.writer()
+		c.release()
+		return
+	}
+
+	s.connected(c, zap.String("codec", c.codec.Name()))
+
+	writerDone := make(chan struct{})
+	go func() {
+		c.writer()
+		close(writerDone)
 	}()
+	c.start()
+	err = c.reader()
+	c.disconnect()
+	// 客户端主动关闭时以客户端的关闭码回复
+	if ce, ok := err.(*websocket.CloseError); ok {
+		c.close(ce.Code, ce.Text)
+	} else {
+		c.close(websocket.CloseNormalClosure, "")
+	}
+	<-writerDone
+	c.finish()
 }
 
-func (c *connection) writer() {
-	for message := range c.sc {
-		c.ws.WriteMessage(websocket.TextMessage, message)
+// open 完成来源检查、握手鉴权、连接数限制与 OnConnect 钩子并创建连接，失败时写入错误响应并返回 nil
+func (s *Server) open(w http.ResponseWriter, r *http.Request) (*connection, http.Header) {
+	var (
+		claims         *encryption.CustomClaims
+		responseHeader http.Header
+	)
+	if !s.checkOrigin(r) {
+		http.Error(w, ErrOriginNotAllowed.Error(), http.StatusForbidden)
+		return nil, nil
+	}
+	if s.config.Auth != nil {
+		var (
+			fromProtocol bool
+			err          error
+		)
+		claims, fromProtocol, err = s.config.Auth.authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return nil, nil
+		}
+		if fromProtocol {
+			responseHeader = http.Header{"Sec-Websocket-Protocol": {tokenProtocol}}
+		}
+	}
+	c := newConnection(s, r)
+	if s.limiter != nil {
+		if !s.limiter.acquire(c.ip) {
+			http.Error(w, "too many connections", http.StatusTooManyRequests)
+			return nil, nil
+		}
+		c.limitIp = c.ip
+	}
+	if claims != nil {
+		c.bindClaims(claims)
+	}
+	if err := c.runHooks(func(h Hook) error { return h.OnConnect(c.hookConn, r) }); err != nil {
+		c.release()
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, nil
 	}
-	c.ws.Close()
+	return c, responseHeader
+}
+
+// start 创建可恢复的会话并发送握手消息
+func (c *connection) start() {
+	if c.server.sessions != nil {
+		c.session = c.server.sessions.create(c)
+	}
+	c.handshake()
+}
+
+// disconnect 连接断开后退出房间，启用会话恢复时保留房间成员身份，等待客户端重连
+func (c *connection) disconnect() {
+	if !c.detach() {
+		c.leave()
+	}
+}
+
+// connected 记录新建立的连接
+func (s *Server) connected(c *connection, fields ...zap.Field) {
+	atomic.AddUint64(&s.metrics.connections, 1)
+	s.logger.Logger.Info("connection opened", append(c.logFields(), fields...)...)
+}
+
+// finish 连接的读写协程退出后注销连接并执行 OnDisconnect 钩子
+func (c *connection) finish() {
+	c.server.logger.Logger.Info("connection closed", append(c.logFields(),
+		zap.Int("close_code", c.closeCode), zap.String("close_text", c.closeText),
+		zap.Duration("duration", time.Since(c.since)))...)
+	c.server.uids.remove(uidKey(c.uid), c)
+	c.server.removeConn(c)
+	c.release()
+	_ = c.runHooks(func(h Hook) error {
+		h.OnDisconnect(c.hookConn)
+		return nil
+	})
 }
 
-func (c *connection) reader() {
+// release 释放连接占用的连接数配额并停止 token 过期计时
+func (c *connection) release() {
+	if c.expire != nil {
+		c.expire.Stop()
+	}
+	if c.limitIp != "" {
+		c.server.limiter.release(c.limitIp)
+		c.limitIp = ""
+	}
+}
+
+// handshake 向客户端发送握手消息
+func (c *connection) handshake() {
+	payload := &HandshakePayload{Ip: c.ip, Uid: c.uid, Conn: c.id}
+	if c.session != nil {
+		payload.Session = c.session.id
+	}
+	c.trySend(NewEnvelope(TypeHandshake, payload).encode())
+}
+
+// join 加入房间，已在其他房间时先退出原房间，鉴权连接的用户名固定为 uid，登录时的用户名作为显示名称
+// 纯数字的用户名保留给鉴权用户，避免匿名用户冒用 uid 接收私聊消息或继承角色，服务端推送与机器人的名称在所有房间中保留
+func (c *connection) join(room string, user string, password string, seq int64) error {
+	if c.claims == nil && numeric(user) {
+		return newProtocolError(CodeInvalidPayload, "numeric names are reserved for authenticated users")
+	}
+	if c.server.reservedName(user) {
+		return newProtocolError(CodeNameTaken, "name is reserved")
+	}
+	c.leave()
+	name := user
+	if c.claims != nil {
+		user = strconv.FormatInt(c.uid, 10)
+		if name == "" {
+			name = user
+		}
+	}
+	c.room = room
+	c.user = user
+	c.name = name
+	var (
+		owner    *RoomRole
+		err      error
+		h        *hub
+		verified string
+		replay   = c.server.replayEnabled()
+	)
 	for {
-		_, message, err := c.ws.ReadMessage()
-		if err != nil {
+		h = c.server.rooms.join(room, func(h *hub) {
+			if owner, err = h.admit(c, verified); err == nil && replay {
+				h.hold(c)
+			}
+		})
+		check, ok := err.(*passwordCheck)
+		if !ok {
 			break
 		}
-		json.Unmarshal(message, &c.data)
-		fmt.Println(string(message))
-		h := hubMap[c.data.Room]
-		if h == nil {
-			h = NewHub()
-			hubMap[c.data.Room] = h
-			go run(h)
-		}
-		switch c.data.Type {
-		case "login":
-			h.c[c] = true
-			c.data.User = c.data.Content
-			c.data.From = c.data.User
-			h.userList = append(h.userList, c.data.User)
-			c.data.UserList = h.userList
-			data_b, _ := json.Marshal(c.data)
-			h.b <- data_b
-		case "user":
-			c.data.Type = "user"
-			data_b, _ := json.Marshal(c.data)
-			h.b <- data_b
-		case "logout":
-			c.data.Type = "logout"
-			h.userList = del(h.userList, c.data.User)
-			data_b, _ := json.Marshal(c.data)
-			h.b <- data_b
-			rChan <- c
-		default:
-			fmt.Print("========default================")
+		// bcrypt 校验耗时较长，在读协程内校验后重试，避免阻塞房间协程
+		if !checkPassword(check.hash, password) {
+			return newProtocolError(CodeWrongPassword, "wrong room password")
+		}
+		verified = check.hash
+	}
+	if h == nil || err != nil {
+		return err
+	}
+	c.hub = h
+	if replay {
+		c.replay(h, seq)
+	}
+	c.server.users.add(c.user, c)
+	c.server.logger.Logger.Info("joined room", c.logFields()...)
+	if store := c.server.rooms.moderation; owner != nil && store != nil {
+		if err := store.SaveRole(owner); err != nil {
+			c.logError(err)
 		}
 	}
+	return nil
 }
 
-func del(slice []string, user string) []string {
-	count := len(slice)
-	if count == 0 {
-		return slice
+// reservedName 名称是否为服务端推送的默认发送方或机器人名称，用户不能以这些名称加入任何房间
+func (s *Server) reservedName(name string) bool {
+	if name == defaultPushFrom {
+		return true
 	}
-	if count == 1 && slice[0] == user {
-		return []string{}
+	for _, b := range s.config.Bots {
+		if b.config.Name == name {
+			return true
+		}
 	}
-	var n_slice = []string{}
-	for i := range slice {
-		if slice[i] == user && i == count {
-			return slice[:count]
-		} else if slice[i] == user {
-			n_slice = append(slice[:i], slice[i+1:]...)
-			break
+	return false
+}
+
+// numeric 字符串是否由数字组成
+func numeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
 		}
 	}
-	fmt.Println(n_slice)
-	return n_slice
+	return true
+}
+
+// leave 退出当前房间并广播下线消息
+func (c *connection) leave() {
+	if c.hub == nil {
+		return
+	}
+	h := c.hub
+	h.call(func() { h.removeMember(c) })
+	c.server.users.remove(c.user, c)
+	c.hub = nil
+	c.server.logger.Logger.Info("left room", c.logFields()...)
+	_ = c.runHooks(func(hook Hook) error {
+		hook.OnLogout(c.hookConn, h.name)
+		return nil
+	})
+}
+
+// trySend 将 JSON 编码的消息转换为连接协商的编码后写入发送队列
+func (c *connection) trySend(data []byte) bool {
+	f := newFrames(data)
+	message, err := f.get(c.codec)
+	if err != nil {
+		c.server.logger.Logger.Error(err.Error(), zap.String("ip", c.ip), zap.String("codec", c.codec.Name()))
+		return true
+	}
+	return c.enqueue(message, f)
+}
+
+// enqueue 非阻塞写入发送队列，队列已满时按慢消费者策略处理，需要断开连接时关闭连接并返回 false。
+// message 为 f 按连接编码后的消息，合并策略下由 f 提供消息类别
+func (c *connection) enqueue(message []byte, f *frames) bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+	}
+	policy, key := c.server.config.SlowConsumer, ""
+	if policy == SlowConsumerCoalesce {
+		key = f.coalesceKey()
+	}
+	ok, overflow := c.queue.push(message, key, policy)
+	if overflow {
+		atomic.AddInt64(&c.server.slowConsumers, 1)
+	}
+	if !ok {
+		c.server.logger.Logger.Warn("slow consumer disconnected", zap.String("ip", c.ip), zap.Int("queue_size", c.queue.size))
+		c.close(CloseSlowConsumer, "slow consumer")
+	}
+	return ok
 }
 
-func run(h *hub) {
+// close 关闭连接，写协程发送完队列中的消息后发送关闭帧
+func (c *connection) close(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.done)
+	})
+}
+
+func (c *connection) writer() {
+	ticker := time.NewTicker(c.server.config.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.ws.Close()
+	}()
 	for {
 		select {
-		case c := <-h.u:
-			if _, ok := h.c[c]; ok {
-				delete(h.c, c)
-				close(c.sc)
+		case <-c.queue.notify:
+			if err := c.drain(); err != nil {
+				return
 			}
-		case data := <-h.b:
-			for c := range h.c {
-				select {
-				case c.sc <- data:
-				default:
-					delete(h.c, c)
-					close(c.sc)
-				}
+		case <-ticker.C:
+			// 心跳，写失败说明连接已断开
+			deadline := time.Now().Add(c.server.config.WriteTimeout)
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
 			}
+		case <-c.done:
+			// 发送队列溢出时客户端已无法及时接收，不再发送剩余消息
+			if c.closeCode != CloseSlowConsumer {
+				c.flush()
+			}
+			_ = c.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(c.closeCode, c.closeText), time.Now().Add(closeWriteWait))
+			return
+		}
+	}
+}
+
+// write 在写超时时间内发送一条消息
+func (c *connection) write(message []byte) error {
+	_ = c.ws.SetWriteDeadline(time.Now().Add(c.server.config.WriteTimeout))
+	if err := c.ws.WriteMessage(c.codec.MessageType(), message); err != nil {
+		return err
+	}
+	atomic.AddUint64(&c.server.metrics.messagesOut, 1)
+	return nil
+}
+
+// drain 发送队列中的消息，连接关闭时停止以便尽快发送关闭帧
+func (c *connection) drain() error {
+	for {
+		select {
+		case <-c.done:
+			return nil
+		default:
+		}
+		message, ok := c.queue.pop()
+		if !ok {
+			return nil
+		}
+		if err := c.write(message); err != nil {
+			return err
+		}
+	}
+}
+
+// flush 发送队列中剩余的消息
+func (c *connection) flush() {
+	for {
+		message, ok := c.queue.pop()
+		if !ok {
+			return
+		}
+		if err := c.write(message); err != nil {
+			return
+		}
+	}
+}
+
+// reader 读取并处理客户端消息，返回导致读取结束的错误
+func (c *connection) reader() error {
+	pongWait := c.server.config.PongWait
+	c.ws.SetReadLimit(c.server.config.MaxMessageSize)
+	_ = c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, message, err := c.ws.ReadMessage()
+		if err != nil {
+			return err
 		}
+		_ = c.ws.SetReadDeadline(time.Now().Add(pongWait))
+		c.receive(message)
+	}
+}
+
+// receive 处理一条客户端消息并回复 ack 或 nack，同一连接的消息必须串行处理
+func (c *connection) receive(message []byte) {
+	atomic.AddUint64(&c.server.metrics.messagesIn, 1)
+	env := &Envelope{}
+	parseErr := c.codec.Unmarshal(message, env)
+	// 格式错误的消息同样计入限流
+	if err := c.limit(len(message)); err != nil {
+		c.nack(env.Id, err)
+		return
+	}
+	if parseErr != nil {
+		c.nack("", newProtocolError(CodeMalformedMessage, parseErr.Error()))
+		return
+	}
+	if env.V != ProtocolVersion {
+		c.nack(env.Id, newProtocolError(CodeUnsupportedVersion, fmt.Sprintf("unsupported protocol version %d", env.V)))
+		return
+	}
+	// 客户端重试已处理过的消息时只回复原 ack
+	if ack, ok := c.acks[env.Id]; ok && env.Id != "" {
+		c.trySend(ack)
+		return
+	}
+	// Meta 只能由钩子填充
+	env.Meta = nil
+	err := c.runHooks(func(h Hook) error { return h.OnMessage(c.hookConn, env) })
+	if err == ErrMessageHandled {
+		c.ack(env.Id, 0)
+		return
+	}
+	if err != nil {
+		c.nack(env.Id, err)
+		return
+	}
+	seq, err := c.handle(env)
+	if err != nil {
+		c.nack(env.Id, err)
+		return
+	}
+	c.ack(env.Id, seq)
+}
+
+// handle 处理客户端消息，返回服务端分配的消息序号
+func (c *connection) handle(env *Envelope) (int64, error) {
+	switch env.Type {
+	case TypeLogin:
+		var payload LoginPayload
+		if err := env.DecodePayload(&payload); err != nil {
+			return 0, err
+		}
+		if err := c.runHooks(func(h Hook) error { return h.OnLogin(c.hookConn, env.Room, &payload) }); err != nil {
+			return 0, err
+		}
+		if err := c.join(env.Room, payload.Name, payload.Password, payload.Seq); err != nil {
+			return 0, err
+		}
+		c.deliverInbox()
+	case TypeUser:
+		var payload TextPayload
+		if err := env.DecodePayload(&payload); err != nil {
+			return 0, err
+		}
+		h := c.hub
+		if h == nil {
+			return 0, newProtocolError(CodeNotLoggedIn, "not logged in")
+		}
+		muted := false
+		h.call(func() { muted = h.muted(c) })
+		if muted {
+			return 0, newProtocolError(CodeMuted, "muted in room")
+		}
+		content, err := c.filter(TypeUser, "", payload.Content)
+		if err != nil {
+			return 0, err
+		}
+		payload.Content = content
+		msg := NewEnvelope(TypeUser, &payload)
+		msg.Room, msg.Uid, msg.From, msg.Meta = c.room, c.uid, c.user, env.Meta
+		if !h.post(msg, func(env *Envelope) { c.record(env, payload.Content) }) {
+			return 0, newProtocolError(CodeNotLoggedIn, "not logged in")
+		}
+		c.trackSent(c.room, msg.Seq, time.UnixMilli(msg.Ts))
+		c.dispatchBots(msg, payload.Content)
+		return msg.Seq, nil
+	case TypeLogout:
+		c.leave()
+		c.handshake()
+	case TypeDirect:
+		var payload TextPayload
+		if err := env.DecodePayload(&payload); err != nil {
+			return 0, err
+		}
+		return 0, c.sendDirect(env.To, payload.Content, env.Meta)
+	case TypeInboxRead:
+		var payload InboxReadPayload
+		if err := env.DecodePayload(&payload); err != nil {
+			return 0, err
+		}
+		return 0, c.markRead(&payload)
+	case TypeTyping:
+		var payload TypingPayload
+		if err := env.DecodePayload(&payload); err != nil {
+			return 0, err
+		}
+		return 0, c.typing(env, &payload)
+	case TypeRead:
+		var payload ReceiptPayload
+		if err := env.DecodePayload(&payload); err != nil {
+			return 0, err
+		}
+		return 0, c.receipt(env, &payload)
+	case TypeRecall:
+		var payload RecallPayload
+		if err := env.DecodePayload(&payload); err != nil {
+			return 0, err
+		}
+		return 0, c.recall(&payload)
+	case TypePresence:
+		var payload PresencePayload
+		if err := env.DecodePayload(&payload); err != nil {
+			return 0, err
+		}
+		return 0, c.presence(&payload)
+	case TypeResume:
+		var payload ResumePayload
+		if err := env.DecodePayload(&payload); err != nil {
+			return 0, err
+		}
+		return 0, c.resume(&payload)
+	case TypeModerate:
+		var payload ModeratePayload
+		if err := env.DecodePayload(&payload); err != nil {
+			return 0, err
+		}
+		return 0, c.moderate(&payload)
+	case TypeRefresh:
+		var payload RefreshPayload
+		if err := env.DecodePayload(&payload); err != nil {
+			return 0, err
+		}
+		return 0, c.refreshToken(payload.Token)
+	default:
+		return 0, newProtocolError(CodeUnknownType, fmt.Sprintf("unknown message type %q", env.Type))
+	}
+	return 0, nil
+}
+
+// ack 回复消息处理成功并缓存，客户端未提供消息标识时不回复
+func (c *connection) ack(id string, seq int64) {
+	if id == "" {
+		return
+	}
+	env := NewEnvelope(TypeAck, nil)
+	env.Id, env.Seq, env.Room = id, seq, c.room
+	ack := env.encode()
+	c.acks[id] = ack
+	c.ackIds = append(c.ackIds, id)
+	if len(c.ackIds) > ackCacheSize {
+		delete(c.acks, c.ackIds[0])
+		c.ackIds = c.ackIds[1:]
+	}
+	c.trySend(ack)
+}
+
+// nack 回复消息处理失败
+func (c *connection) nack(id string, err error) {
+	payload := &NackPayload{Code: CodeInternalError, Message: err.Error()}
+	if pe, ok := err.(*ProtocolError); ok {
+		payload.Code, payload.Message = pe.Code, pe.Message
 	}
+	env := NewEnvelope(TypeNack, payload)
+	env.Id = id
+	c.trySend(env.encode())
 }
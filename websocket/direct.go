@@ -0,0 +1,101 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  direct
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 6:20 下午
+ */
+
+package websocket
+
+import "sync"
+
+// userIndex 在线用户索引，记录每个用户的所有连接
+type userIndex struct {
+	backplane *Backplane
+
+	mu    sync.Mutex
+	users map[string]map[*connection]struct{}
+}
+
+func newUserIndex() *userIndex {
+	return &userIndex{users: make(map[string]map[*connection]struct{})}
+}
+
+// add 登记用户连接，用户首个连接上线时订阅其他节点发给该用户的消息
+func (u *userIndex) add(name string, c *connection) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	conns := u.users[name]
+	if conns == nil {
+		conns = make(map[*connection]struct{})
+		u.users[name] = conns
+		if u.backplane != nil {
+			u.backplane.subscribeUser(name)
+		}
+	}
+	conns[c] = struct{}{}
+}
+
+// remove 移除用户连接，用户最后一个连接下线时取消订阅
+func (u *userIndex) remove(name string, c *connection) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	conns := u.users[name]
+	if conns == nil {
+		return
+	}
+	delete(conns, c)
+	if len(conns) == 0 {
+		delete(u.users, name)
+		if u.backplane != nil {
+			u.backplane.unsubscribeUser(name)
+		}
+	}
+}
+
+// online 用户是否在本节点在线
+func (u *userIndex) online(name string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.users[name]) > 0
+}
+
+// send 向用户在本节点的所有连接发送消息，返回成功写入的连接数
+func (u *userIndex) send(name string, data []byte) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	count := 0
+	for c := range u.users[name] {
+		if c.trySend(data) {
+			count++
+		}
+	}
+	return count
+}
+
+// sendDirect 处理私聊消息，仅投递给接收用户的所有连接，接收用户不在线时返回错误
+func (c *connection) sendDirect(to string, content string, meta map[string]string) error {
+	if c.hub == nil {
+		return newProtocolError(CodeNotLoggedIn, "not logged in")
+	}
+	if to == "" {
+		return newProtocolError(CodeInvalidPayload, "recipient required")
+	}
+	content, err := c.filter(TypeDirect, to, content)
+	if err != nil {
+		return err
+	}
+	msg := NewEnvelope(TypeDirect, &TextPayload{Content: content})
+	msg.Room, msg.Uid, msg.From, msg.To, msg.Meta = c.room, c.uid, c.user, to, meta
+	data_b := msg.encode()
+	delivered := c.server.users.send(to, data_b) > 0
+	if bp := c.server.rooms.backplane; bp != nil && bp.sendDirect(to, data_b) {
+		delivered = true
+	}
+	if !delivered {
+		return newProtocolError(CodeUserOffline, ErrUserOffline.Error())
+	}
+	c.record(msg, content)
+	return nil
+}
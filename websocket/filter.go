@@ -0,0 +1,60 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  filter
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 11:10 上午
+ */
+
+package websocket
+
+import "go.uber.org/zap"
+
+// FilterMessage 待过滤的消息，过滤器可修改 Content 或追加标记
+type FilterMessage struct {
+	Type    string   // 消息类型
+	Room    string   // 房间名
+	Uid     int64    // 发送用户 uid
+	From    string   // 发送用户
+	To      string   // 私聊接收用户
+	Content string   // 消息内容
+	Flags   []string // 标记原因，带有标记的消息仍会发送，由业务方审核
+}
+
+// Flag 标记消息
+func (m *FilterMessage) Flag(reason string) {
+	m.Flags = append(m.Flags, reason)
+}
+
+// MessageFilter 消息过滤器，返回错误时拒绝发送，非协议错误以 CodeContentRejected 回复客户端
+type MessageFilter interface {
+	Filter(msg *FilterMessage) error
+}
+
+// MessageFilterFunc 函数形式的消息过滤器
+type MessageFilterFunc func(msg *FilterMessage) error
+
+func (f MessageFilterFunc) Filter(msg *FilterMessage) error {
+	return f(msg)
+}
+
+// filter 依次执行过滤器，返回处理后的消息内容
+func (c *connection) filter(typ string, to string, content string) (string, error) {
+	filters := c.server.config.Filters
+	if len(filters) == 0 {
+		return content, nil
+	}
+	msg := &FilterMessage{Type: typ, Room: c.room, Uid: c.uid, From: c.user, To: to, Content: content}
+	for _, f := range filters {
+		if err := f.Filter(msg); err != nil {
+			if _, ok := err.(*ProtocolError); ok {
+				return "", err
+			}
+			return "", newProtocolError(CodeContentRejected, err.Error())
+		}
+	}
+	if len(msg.Flags) > 0 {
+		c.server.logger.Logger.Warn("message flagged", append(c.logFields(), zap.Strings("flags", msg.Flags))...)
+	}
+	return msg.Content, nil
+}
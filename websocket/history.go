@@ -0,0 +1,279 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  history
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 7:30 下午
+ */
+
+package websocket
+
+import (
+	"go-library/databases"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultHistoryReplay   = 20
+	defaultHistoryPageSize = 20
+	maxHistoryPageSize     = 500
+)
+
+// Message 聊天记录
+type Message struct {
+	Id        int64     `gorm:"primaryKey;autoIncrement" json:"id"`          // 记录标识
+	Room      string    `gorm:"size:128;index:idx_room_seq" json:"room"`     // 房间名
+	Seq       int64     `gorm:"index:idx_room_seq" json:"seq"`               // 房间内消息序号，私聊消息为 0
+	Type      string    `gorm:"size:32" json:"type"`                         // 消息类型
+	Uid       int64     `gorm:"index" json:"uid"`                            // 发送用户 uid，匿名用户为 0
+	From      string    `gorm:"column:from_user;size:128;index" json:"from"` // 发送用户
+	To        string    `gorm:"column:to_user;size:128;index" json:"to"`     // 私聊接收用户，房间消息为空
+	Content   string    `gorm:"type:text" json:"content"`                    // 消息内容
+	Ip        string    `gorm:"size:64" json:"ip"`                           // 发送方地址
+	Recalled  bool      `gorm:"default:false" json:"recalled"`               // 是否已撤回
+	CreatedAt time.Time `gorm:"index" json:"created_at"`                     // 发送时间
+}
+
+func (Message) TableName() string {
+	return "websocket_message"
+}
+
+// envelope 转换为协议消息
+func (m *Message) envelope() *Envelope {
+	env := NewEnvelope(m.Type, &TextPayload{Content: m.Content})
+	env.Seq = m.Seq
+	env.Ts = m.CreatedAt.UnixMilli()
+	env.Room = m.Room
+	env.Uid = m.Uid
+	env.From = m.From
+	env.To = m.To
+	return env
+}
+
+// HistoryQuery 聊天记录分页查询条件，零值字段不参与过滤
+type HistoryQuery struct {
+	Room     string    // 房间名
+	User     string    // 发送或接收用户
+	Type     string    // 消息类型
+	Start    time.Time // 开始时间（包含）
+	End      time.Time // 结束时间（不包含）
+	Page     int       // 页码，从 1 开始
+	PageSize int       // 每页数量，默认 20，最大 500
+}
+
+// HistoryStore 聊天记录存储
+type HistoryStore interface {
+	// Save 保存消息
+	Save(msg *Message) error
+	// LastSeq 房间最后一条消息的序号
+	LastSeq(room string) (int64, error)
+	// Recent 房间最近的 limit 条消息，按序号升序
+	Recent(room string, limit int) ([]Message, error)
+	// Since 房间中序号大于 seq 的前 limit 条消息，按序号升序
+	Since(room string, seq int64, limit int) ([]Message, error)
+	// Query 分页查询，按记录标识降序
+	Query(query *HistoryQuery) (messages []Message, total int64, err error)
+}
+
+// GormHistoryStore 基于 gorm 的聊天记录存储
+type GormHistoryStore struct {
+	db *gorm.DB
+}
+
+// NewGormHistoryStore 创建聊天记录存储并迁移数据表
+func NewGormHistoryStore(db *databases.GormDB) (*GormHistoryStore, error) {
+	if err := db.AutoMigrate(&Message{}); err != nil {
+		return nil, err
+	}
+	return &GormHistoryStore{db: db.GetDBClient()}, nil
+}
+
+// NewGormHistoryStoreWithDB 使用已有的 gorm 连接创建聊天记录存储，不迁移数据表
+func NewGormHistoryStoreWithDB(db *gorm.DB) *GormHistoryStore {
+	return &GormHistoryStore{db: db}
+}
+
+func (s *GormHistoryStore) Save(msg *Message) error {
+	return s.db.Create(msg).Error
+}
+
+func (s *GormHistoryStore) LastSeq(room string) (seq int64, err error) {
+	err = s.db.Model(&Message{}).Where("room = ? AND to_user = ''", room).
+		Select("COALESCE(MAX(seq), 0)").Scan(&seq).Error
+	return
+}
+
+func (s *GormHistoryStore) Recent(room string, limit int) (messages []Message, err error) {
+	err = s.db.Where("room = ? AND to_user = '' AND recalled = ?", room, false).Order("seq DESC").Limit(limit).Find(&messages).Error
+	if err != nil {
+		return
+	}
+	// 倒序查询后恢复为升序
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return
+}
+
+func (s *GormHistoryStore) Since(room string, seq int64, limit int) (messages []Message, err error) {
+	err = s.db.Where("room = ? AND to_user = '' AND seq > ? AND recalled = ?", room, seq, false).Order("seq ASC").Limit(limit).Find(&messages).Error
+	return
+}
+
+func (s *GormHistoryStore) Recall(room string, seq int64) error {
+	return s.db.Model(&Message{}).Where("room = ? AND to_user = '' AND seq = ?", room, seq).Update("recalled", true).Error
+}
+
+func (s *GormHistoryStore) Export(room string, start time.Time, end time.Time, f func(msg *Message) error) error {
+	tx := s.db.Model(&Message{}).Where("room = ?", room)
+	if !start.IsZero() {
+		tx = tx.Where("created_at >= ?", start)
+	}
+	if !end.IsZero() {
+		tx = tx.Where("created_at < ?", end)
+	}
+	// 按记录标识分批读取，避免一次加载整个房间的消息
+	var lastId int64
+	for {
+		var messages []Message
+		if err := tx.Session(&gorm.Session{}).Where("id > ?", lastId).Order("id ASC").Limit(exportBatchSize).Find(&messages).Error; err != nil {
+			return err
+		}
+		for i := range messages {
+			if err := f(&messages[i]); err != nil {
+				return err
+			}
+		}
+		if len(messages) < exportBatchSize {
+			return nil
+		}
+		lastId = messages[len(messages)-1].Id
+	}
+}
+
+func (s *GormHistoryStore) Purge(query *PurgeQuery) (int64, error) {
+	tx := s.db.Where("created_at < ?", query.Before)
+	if query.Room != "" {
+		tx = tx.Where("room = ?", query.Room)
+	} else if len(query.Exclude) > 0 {
+		tx = tx.Where("room NOT IN ?", query.Exclude)
+	}
+	result := tx.Delete(&Message{})
+	return result.RowsAffected, result.Error
+}
+
+func (s *GormHistoryStore) Query(query *HistoryQuery) (messages []Message, total int64, err error) {
+	tx := s.db.Model(&Message{})
+	if query.Room != "" {
+		tx = tx.Where("room = ?", query.Room)
+	}
+	if query.User != "" {
+		tx = tx.Where("(from_user = ? OR to_user = ?)", query.User, query.User)
+	}
+	if query.Type != "" {
+		tx = tx.Where("type = ?", query.Type)
+	}
+	if !query.Start.IsZero() {
+		tx = tx.Where("created_at >= ?", query.Start)
+	}
+	if !query.End.IsZero() {
+		tx = tx.Where("created_at < ?", query.End)
+	}
+	// 计数与分页查询共用过滤条件，各自在独立的会话上执行
+	tx = tx.Session(&gorm.Session{})
+	if err = tx.Count(&total).Error; err != nil {
+		return
+	}
+	page, pageSize := query.Page, query.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = defaultHistoryPageSize
+	} else if pageSize > maxHistoryPageSize {
+		pageSize = maxHistoryPageSize
+	}
+	err = tx.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&messages).Error
+	return
+}
+
+// record 保存消息到聊天记录
+func (c *connection) record(env *Envelope, content string) {
+	c.server.record(env, content, c.ip)
+}
+
+// record 保存消息到聊天记录，ip 为发送方地址，服务端推送的消息为空
+func (s *Server) record(env *Envelope, content string, ip string) {
+	store := s.config.History
+	if store == nil {
+		return
+	}
+	msg := &Message{
+		Room:      env.Room,
+		Seq:       env.Seq,
+		Type:      env.Type,
+		Uid:       env.Uid,
+		From:      env.From,
+		To:        env.To,
+		Content:   content,
+		Ip:        ip,
+		CreatedAt: time.UnixMilli(env.Ts),
+	}
+	if err := store.Save(msg); err != nil {
+		s.logger.Logger.Error(err.Error(), zap.String("room", env.Room), zap.Int64("seq", env.Seq))
+	}
+}
+
+// replayEnabled 是否在加入房间时补发聊天记录
+func (s *Server) replayEnabled() bool {
+	return s.config.History != nil && s.config.HistoryReplay > 0
+}
+
+// replay 加入房间后补发聊天记录，seq 大于 0 时补发该序号之后的消息，否则补发最近的消息。
+// 在读协程内查询聊天记录，期间的房间消息由房间协程暂存，查询完成后在房间协程内按顺序发送，调用前需在房间协程内调用 hold
+func (c *connection) replay(h *hub, seq int64) {
+	store := c.server.config.History
+	limit := c.server.config.HistoryReplay
+	var (
+		messages []Message
+		err      error
+	)
+	if seq > 0 {
+		messages, err = store.Since(h.name, seq, limit)
+	} else {
+		messages, err = store.Recent(h.name, limit)
+	}
+	if err != nil {
+		c.logError(err)
+		messages = nil
+	}
+	h.call(func() { h.release(c, messages) })
+}
+
+// hold 开始暂存发给连接的房间消息，直到 release，仅在房间协程内调用
+func (h *hub) hold(c *connection) {
+	c.holding, c.pending = true, nil
+}
+
+// release 发送补发的聊天记录与暂存的房间消息，暂存的消息已在聊天记录中补发时跳过，仅在房间协程内调用
+func (h *hub) release(c *connection, messages []Message) {
+	pending := c.pending
+	c.holding, c.pending = false, nil
+	if !h.c[c] {
+		return
+	}
+	replayed := make(map[int64]bool, len(messages))
+	for i := range messages {
+		replayed[messages[i].Seq] = true
+		c.trySend(messages[i].envelope().encode())
+	}
+	for _, msg := range pending {
+		if msg.seq > 0 && replayed[msg.seq] {
+			continue
+		}
+		h.sendFrame(c, newFrames(msg.data))
+	}
+}
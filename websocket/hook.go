@@ -0,0 +1,158 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  hook
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 4:20 下午
+ */
+
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"go-library/encryption"
+	"net/http"
+	"sync"
+)
+
+// ErrMessageHandled 由 Hook.OnMessage 返回，表示消息已由钩子处理，服务端回复 ack 且不再执行内置处理，用于实现自定义消息类型
+var ErrMessageHandled = errors.New("message handled")
+
+// Hook 连接生命周期钩子，在连接的读协程内同步执行，耗时操作应自行启动协程
+type Hook interface {
+	// OnConnect 握手鉴权通过后、升级连接前调用，返回错误时以 403 拒绝连接
+	OnConnect(conn *Conn, r *http.Request) error
+	// OnLogin 登录房间前调用，可修改 payload 中的用户名，返回错误时拒绝登录
+	OnLogin(conn *Conn, room string, payload *LoginPayload) error
+	// OnMessage 处理客户端消息前调用，可修改消息内容或通过 Meta 补充字段，返回错误时拒绝该消息
+	OnMessage(conn *Conn, env *Envelope) error
+	// OnLogout 退出房间后调用，包括切换房间、断线与会话过期
+	OnLogout(conn *Conn, room string)
+	// OnDisconnect 连接关闭后调用
+	OnDisconnect(conn *Conn)
+}
+
+// BaseHook 空实现，嵌入后只需实现关心的方法
+type BaseHook struct{}
+
+func (BaseHook) OnConnect(conn *Conn, r *http.Request) error { return nil }
+
+func (BaseHook) OnLogin(conn *Conn, room string, payload *LoginPayload) error { return nil }
+
+func (BaseHook) OnMessage(conn *Conn, env *Envelope) error { return nil }
+
+func (BaseHook) OnLogout(conn *Conn, room string) {}
+
+func (BaseHook) OnDisconnect(conn *Conn) {}
+
+// Conn 提供给钩子的连接句柄
+type Conn struct {
+	c *connection
+
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+// Ip 客户端地址
+func (conn *Conn) Ip() string {
+	return conn.c.ip
+}
+
+// UserAgent 客户端 UserAgent
+func (conn *Conn) UserAgent() string {
+	return conn.c.userAgent
+}
+
+// Room 当前房间，未登录时为空
+func (conn *Conn) Room() string {
+	if conn.c.hub == nil {
+		return ""
+	}
+	return conn.c.room
+}
+
+// User 当前用户名，未登录时为空
+func (conn *Conn) User() string {
+	return conn.c.user
+}
+
+// Name 当前显示名称，未登录时为空
+func (conn *Conn) Name() string {
+	return conn.c.name
+}
+
+// Uid 鉴权连接的用户 uid，匿名连接为 0
+func (conn *Conn) Uid() int64 {
+	return conn.c.uid
+}
+
+// Claims 握手鉴权得到的 token 信息，匿名连接为空
+func (conn *Conn) Claims() *encryption.CustomClaims {
+	return conn.c.claims
+}
+
+// Send 向该连接发送消息，发送队列已满时返回 false
+func (conn *Conn) Send(env *Envelope) bool {
+	if env.V == 0 {
+		env.V = ProtocolVersion
+	}
+	return conn.c.trySend(env.encode())
+}
+
+// Broadcast 以该连接的身份向当前房间广播消息，消息不分配序号也不保存到聊天记录
+func (conn *Conn) Broadcast(env *Envelope) error {
+	h := conn.c.hub
+	if h == nil {
+		return newProtocolError(CodeNotLoggedIn, "not logged in")
+	}
+	if env.V == 0 {
+		env.V = ProtocolVersion
+	}
+	env.Room, env.Uid, env.From = h.name, conn.c.uid, conn.c.user
+	h.publish(0, env.encode())
+	return nil
+}
+
+// Close 关闭连接
+func (conn *Conn) Close(code int, text string) {
+	conn.c.close(code, text)
+}
+
+// Set 保存连接级数据
+func (conn *Conn) Set(key string, value interface{}) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.values == nil {
+		conn.values = make(map[string]interface{})
+	}
+	conn.values[key] = value
+}
+
+// Get 读取连接级数据
+func (conn *Conn) Get(key string) (interface{}, bool) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	value, ok := conn.values[key]
+	return value, ok
+}
+
+// runHooks 依次执行钩子，遇到错误时停止，钩子 panic 时记录日志并返回内部错误
+func (c *connection) runHooks(f func(h Hook) error) (err error) {
+	hooks := c.server.config.Hooks
+	if len(hooks) == 0 {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("hook panic: %v", r)
+			c.logError(err)
+		}
+	}()
+	for _, h := range hooks {
+		if err = f(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -8,38 +8,329 @@
 
 package websocket
 
-import "encoding/json"
+import (
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// roomMessage 房间广播消息
+type roomMessage struct {
+	seq  int64     // 消息序号，上下线等事件为 0
+	data []byte    // 编码后的消息
+	at   time.Time // 广播时间，用于统计广播延迟
+}
+
+// hub 聊天房间，成员、用户列表、元数据只在 run 协程内读写
 type hub struct {
-	c        map[*connection]bool
-	b        chan []byte
-	u        chan *connection
-	userList []string
+	name      string
+	manager   *roomManager
+	createdAt time.Time
+
+	c        map[*connection]bool // 成员连接，值为 false 表示连接已断开、会话等待恢复
+	presence map[string]*RoomUser // 按用户身份索引的房间用户
+	order    []string             // 用户身份，按首次加入顺序排列
+	metadata map[string]string
+	recent   []roomMessage // 最近的房间消息，用于会话恢复后补发
+	policy   *roomPolicy   // 房间设置、角色与处罚
+
+	seq     int64 // 最后分配的消息序号
+	seqOnce sync.Once
+
+	b     chan roomMessage
+	calls chan func()
+	quit  chan struct{}
+	done  chan struct{}
 }
 
-func NewHub() *hub {
-	return &hub{
-		c:        make(map[*connection]bool),
-		u:        make(chan *connection),
-		b:        make(chan []byte),
-		userList: []string{},
+func newHub(name string, manager *roomManager) *hub {
+	h := &hub{
+		name:      name,
+		manager:   manager,
+		createdAt: time.Now(),
+		c:         make(map[*connection]bool),
+		presence:  make(map[string]*RoomUser),
+		metadata:  make(map[string]string),
+		b:         make(chan roomMessage),
+		calls:     make(chan func()),
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
 	}
+	h.addBots(manager.bots)
+	return h
 }
 
-var (
-	hubMap = make(map[string]*hub)
-	rChan  = make(chan *connection)
-)
-
-func runChan() {
+func (h *hub) run() {
+	defer close(h.done)
+	h.loadPolicy()
+	var (
+		idle  *time.Timer
+		idleC <-chan time.Time
+	)
+	// 房间为空时开始计时，超过空闲时间后销毁房间
+	checkIdle := func() {
+		if len(h.c) == 0 && idle == nil {
+			idle = time.NewTimer(h.manager.idleTimeout)
+			idleC = idle.C
+		} else if len(h.c) > 0 && idle != nil {
+			idle.Stop()
+			idle, idleC = nil, nil
+		}
+	}
+	checkIdle()
 	for {
 		select {
-		case c := <-rChan:
-			c.data.Ip = c.ws.RemoteAddr().String()
-			c.data.Type = "handshake"
-			//c.data.UserList = user_list
-			data_b, _ := json.Marshal(c.data)
-			c.sc <- data_b
+		case f := <-h.calls:
+			f()
+			checkIdle()
+		case msg := <-h.b:
+			h.deliver(msg)
+			checkIdle()
+		case <-idleC:
+			idle, idleC = nil, nil
+			if len(h.c) == 0 && h.manager.remove(h) {
+				return
+			}
+			checkIdle()
+		case <-h.quit:
+			if idle != nil {
+				idle.Stop()
+			}
+			for c := range h.c {
+				c.close(websocket.CloseGoingAway, "server shutdown")
+			}
+			return
+		}
+	}
+}
+
+// deliver 缓存并向房间成员发送消息，记录广播延迟，仅在房间协程内调用
+func (h *hub) deliver(msg roomMessage) {
+	h.remember(msg)
+	h.send(msg.seq, msg.data)
+	if m := h.manager.metrics; m != nil {
+		m.latency.observe(time.Since(msg.at))
+	}
+}
+
+// send 向房间所有在线成员发送消息，每种编码只编码一次，编码失败时跳过该连接，因发送队列溢出被断开的连接移出房间并广播下线消息。
+// 正在补发聊天记录的连接暂存消息，暂存数超过发送队列长度时按慢消费者断开
+func (h *hub) send(seq int64, data []byte) {
+	f := newFrames(data)
+	for c, attached := range h.c {
+		if !attached {
+			continue
 		}
+		if !c.holding {
+			h.sendFrame(c, f)
+		} else if len(c.pending) < c.queue.size {
+			c.pending = append(c.pending, roomMessage{seq: seq, data: data})
+		} else {
+			atomic.AddInt64(&c.server.slowConsumers, 1)
+			c.close(CloseSlowConsumer, "slow consumer")
+			h.removeMember(c)
+		}
+	}
+}
+
+// sendUser 向房间内该用户的所有连接发送消息，仅在房间协程内调用
+func (h *hub) sendUser(user string, data []byte) {
+	f := newFrames(data)
+	for c, attached := range h.c {
+		if attached && c.user == user {
+			h.sendFrame(c, f)
+		}
+	}
+}
+
+// sendFrame 按连接的编码发送消息，编码失败时跳过，发送队列溢出时移出房间，仅在房间协程内调用
+func (h *hub) sendFrame(c *connection, f *frames) {
+	message, err := f.get(c.codec)
+	if err != nil {
+		c.logError(err)
+		return
+	}
+	if !c.enqueue(message, f) {
+		h.removeMember(c)
+	}
+}
+
+// call 在房间协程内执行 f 并等待完成，房间已销毁时返回 false
+func (h *hub) call(f func()) bool {
+	finished := make(chan struct{})
+	select {
+	case h.calls <- func() {
+		defer close(finished)
+		f()
+	}:
+	case <-h.done:
+		return false
+	}
+	<-finished
+	return true
+}
+
+// broadcast 向房间广播消息，房间已销毁时直接丢弃
+func (h *hub) broadcast(seq int64, data []byte) {
+	select {
+	case h.b <- roomMessage{seq: seq, data: data, at: time.Now()}:
+	case <-h.done:
+	}
+}
+
+// remember 记录最近的房间消息，仅在房间协程内调用
+func (h *hub) remember(msg roomMessage) {
+	size := h.manager.bufferSize
+	if msg.seq == 0 || size <= 0 {
+		return
+	}
+	h.recent = append(h.recent, msg)
+	if len(h.recent) > size {
+		h.recent = h.recent[len(h.recent)-size:]
+	}
+}
+
+// since 获取序号大于 seq 的最近消息，complete 表示缓存中包含了 seq 之后的全部消息，仅在房间协程内调用
+func (h *hub) since(seq int64) (messages [][]byte, complete bool) {
+	complete = len(h.recent) == 0 || h.recent[0].seq <= seq+1 || atomic.LoadInt64(&h.seq) <= seq
+	for _, msg := range h.recent {
+		if msg.seq > seq {
+			messages = append(messages, msg.data)
+		}
+	}
+	return
+}
+
+// stop 停止房间协程并等待其退出
+func (h *hub) stop() {
+	select {
+	case <-h.quit:
+	default:
+		close(h.quit)
+	}
+	<-h.done
+}
+
+// addMember 加入房间，用户的第一个连接加入时广播上线消息，其他连接只向该连接发送用户列表，仅在房间协程内调用
+func (h *hub) addMember(c *connection) {
+	h.c[c] = true
+	key := c.presenceKey()
+	if u := h.presence[key]; u != nil {
+		u.Devices++
+		c.name = u.Name
+		env := NewEnvelope(TypeLogin, &MemberPayload{User: c.user, Name: c.name, Uid: c.uid, Ip: c.ip, UserList: h.users()})
+		env.Room, env.Uid, env.From = h.name, c.uid, c.user
+		c.trySend(env.encode())
+		return
+	}
+	h.presence[key] = &RoomUser{Id: c.user, Uid: c.uid, Name: c.name, Status: StatusOnline, Devices: 1}
+	h.order = append(h.order, key)
+	h.memberChanged(TypeLogin, c)
+}
+
+// removeMember 移出房间，用户的最后一个连接离开时广播下线消息，仅在房间协程内调用
+func (h *hub) removeMember(c *connection) {
+	if _, ok := h.c[c]; !ok {
+		return
+	}
+	delete(h.c, c)
+	key := c.presenceKey()
+	u := h.presence[key]
+	if u == nil {
+		return
+	}
+	if u.Devices--; u.Devices > 0 {
+		return
+	}
+	delete(h.presence, key)
+	for i, k := range h.order {
+		if k == key {
+			h.order = append(h.order[:i], h.order[i+1:]...)
+			break
+		}
+	}
+	h.memberChanged(TypeLogout, c)
+}
+
+// memberChanged 广播上下线消息，启用多节点总线时由总线同步用户列表后广播
+func (h *hub) memberChanged(typ string, c *connection) {
+	payload := &MemberPayload{User: c.user, Name: c.name, Uid: c.uid, Ip: c.ip, UserList: h.users()}
+	env := NewEnvelope(typ, nil)
+	env.Room, env.Uid, env.From = h.name, c.uid, c.user
+	if bp := h.manager.backplane; bp != nil {
+		bp.memberChanged(h.name, env, payload)
+		return
+	}
+	env.SetPayload(payload)
+	h.send(0, env.encode())
+}
+
+// nextSeq 分配房间内消息序号，启用多节点总线时由 redis 分配以保证各节点序号一致
+func (h *hub) nextSeq() int64 {
+	h.seqOnce.Do(h.loadSeq)
+	if bp := h.manager.backplane; bp != nil {
+		seq, err := bp.nextSeq(h.name)
+		if err == nil {
+			atomic.StoreInt64(&h.seq, seq)
+			return seq
+		}
+		bp.logger.Logger.Error(err.Error(), zap.String("room", h.name))
+	}
+	return atomic.AddInt64(&h.seq, 1)
+}
+
+// loadSeq 从聊天记录中恢复房间最后的消息序号
+func (h *hub) loadSeq() {
+	if store := h.manager.history; store != nil {
+		seq, err := store.LastSeq(h.name)
+		if err == nil {
+			atomic.StoreInt64(&h.seq, seq)
+		}
+	}
+	if bp := h.manager.backplane; bp != nil {
+		if err := bp.initSeq(h.name, atomic.LoadInt64(&h.seq)); err != nil {
+			bp.logger.Logger.Error(err.Error(), zap.String("room", h.name))
+		}
+	}
+}
+
+// post 在房间协程内分配消息序号、保存聊天记录并广播，保证序号顺序与投递顺序一致，启用多节点总线时同时发布到其他节点。
+// record 在分配序号后、广播前调用，房间已销毁时返回 false
+func (h *hub) post(env *Envelope, record func(env *Envelope)) bool {
+	return h.call(func() {
+		env.Seq = h.nextSeq()
+		record(env)
+		data := env.encode()
+		h.deliver(roomMessage{seq: env.Seq, data: data, at: time.Now()})
+		if bp := h.manager.backplane; bp != nil {
+			bp.publish(h.name, env.Seq, data)
+		}
+	})
+}
+
+// publish 向房间广播消息，启用多节点总线时同时发布到其他节点
+func (h *hub) publish(seq int64, data []byte) {
+	h.broadcast(seq, data)
+	if bp := h.manager.backplane; bp != nil {
+		bp.publish(h.name, seq, data)
+	}
+}
+
+// info 房间信息快照，仅在房间协程内调用
+func (h *hub) info() RoomInfo {
+	members := h.users()
+	metadata := make(map[string]string, len(h.metadata))
+	for k, v := range h.metadata {
+		metadata[k] = v
+	}
+	return RoomInfo{
+		Name:      h.name,
+		Members:   members,
+		Count:     len(h.c),
+		Metadata:  metadata,
+		CreatedAt: h.createdAt,
 	}
 }
@@ -0,0 +1,274 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  inbox
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 7:10 下午
+ */
+
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultInboxPrefix = "websocket"
+	defaultInboxTTL    = 7 * 24 * time.Hour
+	defaultInboxSize   = 1000
+)
+
+var ErrInboxDisabled = errors.New("inbox disabled")
+
+// InboxMessage 发给指定 uid 的消息，用户已读或过期前保存在收件箱中
+type InboxMessage struct {
+	Id        int64             `json:"id"`             // 收件箱内递增的消息标识
+	Uid       int64             `json:"uid"`            // 接收用户 uid
+	From      string            `json:"from"`           // 发送方名称
+	Content   string            `json:"content"`        // 消息内容
+	Meta      map[string]string `json:"meta,omitempty"` // 扩展字段
+	CreatedAt int64             `json:"created_at"`     // 创建时间（毫秒）
+	ExpiresAt int64             `json:"expires_at"`     // 过期时间（毫秒）
+}
+
+// InboxPayload 收件箱消息内容，登录时下发全部未读消息，之后实时下发新消息，已读变更时只更新未读数
+type InboxPayload struct {
+	Messages []*InboxMessage `json:"messages,omitempty"` // 按标识升序的消息
+	Unread   int64           `json:"unread"`             // 未读消息数
+}
+
+// InboxReadPayload 标记已读消息内容
+type InboxReadPayload struct {
+	Id int64 `json:"id"` // 标识小于等于 Id 的消息均标记为已读
+}
+
+// InboxStore 离线收件箱存储
+type InboxStore interface {
+	// Push 保存消息并分配消息标识
+	Push(msg *InboxMessage) error
+	// Unread 按标识升序获取未读且未过期的消息
+	Unread(uid int64) ([]*InboxMessage, error)
+	// MarkRead 将标识小于等于 id 的消息标记为已读
+	MarkRead(uid int64, id int64) error
+	// Count 未读且未过期的消息数
+	Count(uid int64) (int64, error)
+}
+
+// RedisInboxConfig redis 收件箱配置
+type RedisInboxConfig struct {
+	Prefix  string        // redis key 前缀，默认 websocket
+	TTL     time.Duration // 消息保留时间，默认 7 天
+	MaxSize int64         // 每个用户最多保留的未读消息数，超出时丢弃最早的消息，默认 1000
+}
+
+// RedisInboxStore 基于 redis 有序集合的收件箱，消息按标识排序，另以过期时间为分数索引消息标识用于统计未读数，
+// 收件箱在最后一条消息过期后整体过期
+type RedisInboxStore struct {
+	client *redis.Client
+	config *RedisInboxConfig
+}
+
+// NewRedisInboxStore 创建 redis 收件箱，client 可通过 databases.Redis.NewClient 获取
+func NewRedisInboxStore(client *redis.Client, config *RedisInboxConfig) *RedisInboxStore {
+	if config == nil {
+		config = &RedisInboxConfig{}
+	}
+	if config.Prefix == "" {
+		config.Prefix = defaultInboxPrefix
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaultInboxTTL
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaultInboxSize
+	}
+	return &RedisInboxStore{client: client, config: config}
+}
+
+func (s *RedisInboxStore) inboxKey(uid int64) string {
+	return fmt.Sprintf("%s:inbox:%d", s.config.Prefix, uid)
+}
+
+func (s *RedisInboxStore) idKey(uid int64) string {
+	return fmt.Sprintf("%s:inbox:%d:id", s.config.Prefix, uid)
+}
+
+// expiryKey 以过期时间为分数、消息标识为成员的有序集合
+func (s *RedisInboxStore) expiryKey(uid int64) string {
+	return fmt.Sprintf("%s:inbox:%d:expiry", s.config.Prefix, uid)
+}
+
+func (s *RedisInboxStore) Push(msg *InboxMessage) error {
+	ctx := context.Background()
+	id, err := s.client.Incr(ctx, s.idKey(msg.Uid)).Result()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	msg.Id = id
+	msg.CreatedAt = now.UnixMilli()
+	msg.ExpiresAt = now.Add(s.config.TTL).UnixMilli()
+	msg_b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	key, expiryKey := s.inboxKey(msg.Uid), s.expiryKey(msg.Uid)
+	pipe := s.client.TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(id), Member: msg_b})
+	pipe.ZAdd(ctx, expiryKey, &redis.Z{Score: float64(msg.ExpiresAt), Member: id})
+	// 消息标识连续分配，超出上限的只有标识为 id-MaxSize 的消息
+	if dropped := id - s.config.MaxSize; dropped > 0 {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(dropped, 10))
+		pipe.ZRem(ctx, expiryKey, dropped)
+	}
+	pipe.Expire(ctx, key, s.config.TTL)
+	pipe.Expire(ctx, expiryKey, s.config.TTL)
+	pipe.Expire(ctx, s.idKey(msg.Uid), s.config.TTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisInboxStore) Unread(uid int64) ([]*InboxMessage, error) {
+	values, err := s.client.ZRange(context.Background(), s.inboxKey(uid), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	messages := make([]*InboxMessage, 0, len(values))
+	for _, value := range values {
+		var msg InboxMessage
+		if err := json.Unmarshal([]byte(value), &msg); err != nil || msg.ExpiresAt <= now {
+			continue
+		}
+		messages = append(messages, &msg)
+	}
+	return messages, nil
+}
+
+func (s *RedisInboxStore) MarkRead(uid int64, id int64) error {
+	ctx := context.Background()
+	key, upto := s.inboxKey(uid), strconv.FormatInt(id, 10)
+	read, err := s.client.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: upto}).Result()
+	if err != nil || len(read) == 0 {
+		return err
+	}
+	// 消息的分数即为标识
+	ids := make([]interface{}, len(read))
+	for i, z := range read {
+		ids[i] = int64(z.Score)
+	}
+	pipe := s.client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", upto)
+	pipe.ZRem(ctx, s.expiryKey(uid), ids...)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Count 移除已过期的消息标识后统计未读数
+func (s *RedisInboxStore) Count(uid int64) (int64, error) {
+	ctx := context.Background()
+	key := s.expiryKey(uid)
+	pipe := s.client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	count := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+// SendToUid 向指定 uid 发送消息，消息保存到收件箱直到用户标记已读，用户在线时同时实时下发
+func (s *Server) SendToUid(uid int64, msg *PushMessage) (*InboxMessage, error) {
+	store := s.config.Inbox
+	if store == nil {
+		return nil, ErrInboxDisabled
+	}
+	from := msg.From
+	if from == "" {
+		from = defaultPushFrom
+	}
+	inbox := &InboxMessage{Uid: uid, From: from, Content: msg.Content, Meta: msg.Meta}
+	if err := store.Push(inbox); err != nil {
+		return nil, err
+	}
+	unread, err := store.Count(uid)
+	if err != nil {
+		return nil, err
+	}
+	env := NewEnvelope(TypeInbox, &InboxPayload{Messages: []*InboxMessage{inbox}, Unread: unread})
+	s.sendUid(uid, env.encode())
+	return inbox, nil
+}
+
+// Unread 获取用户未读消息数
+func (s *Server) Unread(uid int64) (int64, error) {
+	store := s.config.Inbox
+	if store == nil {
+		return 0, ErrInboxDisabled
+	}
+	return store.Count(uid)
+}
+
+// sendUid 向 uid 在所有节点上的连接发送消息
+func (s *Server) sendUid(uid int64, data []byte) {
+	s.uids.send(uidKey(uid), data)
+	if bp := s.rooms.backplane; bp != nil {
+		bp.sendUid(uid, data)
+	}
+}
+
+// uidKey uid 在连接索引中的键
+func uidKey(uid int64) string {
+	return strconv.FormatInt(uid, 10)
+}
+
+// deliverInbox 首次登录房间后下发收件箱中的未读消息，之后的新消息实时下发
+func (c *connection) deliverInbox() {
+	store := c.server.config.Inbox
+	if store == nil || c.uid == 0 || c.inboxDelivered {
+		return
+	}
+	c.inboxDelivered = true
+	// 先登记再读取未读消息，期间到达的消息可能重复下发，客户端按消息标识去重
+	c.server.uids.add(uidKey(c.uid), c)
+	messages, err := store.Unread(c.uid)
+	if err != nil {
+		c.logError(err)
+		return
+	}
+	if len(messages) == 0 {
+		return
+	}
+	env := NewEnvelope(TypeInbox, &InboxPayload{Messages: messages, Unread: int64(len(messages))})
+	c.trySend(env.encode())
+}
+
+// markRead 处理标记已读消息，并向该用户的所有连接同步未读数
+func (c *connection) markRead(payload *InboxReadPayload) error {
+	store := c.server.config.Inbox
+	if store == nil {
+		return newProtocolError(CodeUnknownType, ErrInboxDisabled.Error())
+	}
+	if c.uid == 0 {
+		return newProtocolError(CodeInvalidToken, ErrTokenMissing.Error())
+	}
+	if err := store.MarkRead(c.uid, payload.Id); err != nil {
+		c.logError(err)
+		return newProtocolError(CodeInternalError, "mark read failed")
+	}
+	unread, err := c.server.Unread(c.uid)
+	if err != nil {
+		c.logError(err)
+		return newProtocolError(CodeInternalError, "mark read failed")
+	}
+	env := NewEnvelope(TypeInbox, &InboxPayload{Unread: unread})
+	c.server.sendUid(c.uid, env.encode())
+	return nil
+}
@@ -0,0 +1,117 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  metrics
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 2:15 下午
+ */
+
+package websocket
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// latencyBuckets 广播延迟直方图的桶上限（秒）
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// metrics 服务运行计数
+type metrics struct {
+	connections uint64 // 累计建立的连接数
+	messagesIn  uint64 // 收到的客户端消息数
+	messagesOut uint64 // 写出的消息数
+	latency     *histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{latency: newHistogram(latencyBuckets)}
+}
+
+// histogram 累积直方图
+type histogram struct {
+	buckets []float64
+	counts  []uint64 // 落在各桶内的次数，不累积
+	count   uint64
+	sum     int64 // 纳秒
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// observe 记录一次耗时
+func (h *histogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	for i, bound := range h.buckets {
+		if seconds <= bound {
+			atomic.AddUint64(&h.counts[i], 1)
+			break
+		}
+	}
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// serveMetrics 以 Prometheus 文本格式输出运行指标
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	buf := bufio.NewWriter(w)
+	m := s.metrics
+	writeMetric(buf, "websocket_connections", "gauge", "Active connections.", float64(s.ConnectionCount()))
+	writeMetric(buf, "websocket_rooms", "gauge", "Active rooms on this node.", float64(s.RoomCount()))
+	writeMetric(buf, "websocket_connections_total", "counter", "Connections accepted.", float64(atomic.LoadUint64(&m.connections)))
+	writeMetric(buf, "websocket_messages_received_total", "counter", "Messages received from clients.", float64(atomic.LoadUint64(&m.messagesIn)))
+	writeMetric(buf, "websocket_messages_sent_total", "counter", "Messages written to clients.", float64(atomic.LoadUint64(&m.messagesOut)))
+	writeMetric(buf, "websocket_slow_consumer_total", "counter", "Messages dropped, coalesced or connections closed because of a full send queue.", float64(s.SlowConsumerCount()))
+	stats := s.RateLimitStats()
+	writeMetric(buf, "websocket_rate_limited_total", "counter", "Messages rejected by the rate limiter.", float64(stats.Limited))
+	writeMetric(buf, "websocket_rate_limit_disconnects_total", "counter", "Connections closed for repeated rate limit violations.", float64(stats.Disconnects))
+	writeMetric(buf, "websocket_rejected_connections_total", "counter", "Connections rejected by the per address limit.", float64(stats.RejectedConnections))
+
+	h := m.latency
+	name := "websocket_broadcast_latency_seconds"
+	fmt.Fprintf(buf, "# HELP %s Time from room broadcast to fan-out completion.\n# TYPE %s histogram\n", name, name)
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		fmt.Fprintf(buf, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	count := atomic.LoadUint64(&h.count)
+	fmt.Fprintf(buf, "%s_bucket{le=\"+Inf\"} %d\n", name, count)
+	fmt.Fprintf(buf, "%s_sum %s\n", name, strconv.FormatFloat(time.Duration(atomic.LoadInt64(&h.sum)).Seconds(), 'g', -1, 64))
+	fmt.Fprintf(buf, "%s_count %d\n", name, count)
+	_ = buf.Flush()
+}
+
+// writeMetric 输出单值指标
+func writeMetric(buf *bufio.Writer, name string, typ string, help string, value float64) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, typ, name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// logFields 连接的日志字段，不包含消息内容，仅在读协程内或读协程退出后调用
+func (c *connection) logFields() []zap.Field {
+	transport := "websocket"
+	if c.http != nil {
+		transport = c.http.transport
+	}
+	fields := []zap.Field{zap.String("ip", c.ip), zap.String("transport", transport)}
+	if c.uid != 0 {
+		fields = append(fields, zap.Int64("uid", c.uid))
+	}
+	if c.room != "" {
+		fields = append(fields, zap.String("room", c.room), zap.String("user", c.user))
+	}
+	return fields
+}
+
+// logError 记录连接处理过程中的错误，仅在读协程内调用
+func (c *connection) logError(err error) {
+	c.server.logger.Logger.Error(err.Error(), c.logFields()...)
+}
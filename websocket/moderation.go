@@ -0,0 +1,601 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  moderation
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 11:30 下午
+ */
+
+package websocket
+
+import (
+	"fmt"
+	"go-library/databases"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// CloseKicked 被踢出或封禁时的关闭码
+const CloseKicked = 4003
+
+// 房间角色
+const (
+	RoleOwner     = "owner"     // 房主
+	RoleModerator = "moderator" // 管理员
+	RoleMember    = "member"    // 受邀成员
+)
+
+// 房间管理操作
+const (
+	ActionKick     = "kick"     // 踢出用户
+	ActionMute     = "mute"     // 禁言
+	ActionUnmute   = "unmute"   // 解除禁言
+	ActionBan      = "ban"      // 封禁用户或地址
+	ActionUnban    = "unban"    // 解除封禁
+	ActionRole     = "role"     // 设置角色，Role 为空时取消角色
+	ActionSettings = "settings" // 修改房间密码或仅限邀请模式
+)
+
+// 处罚类型
+const (
+	sanctionBan  = "ban"
+	sanctionMute = "mute"
+)
+
+// RoomSetting 房间设置
+type RoomSetting struct {
+	Room       string    `gorm:"primaryKey;size:128" json:"room"`   // 房间名
+	Password   string    `gorm:"size:64" json:"password,omitempty"` // 房间密码的 bcrypt 摘要，为空时不需要密码
+	InviteOnly bool      `json:"invite_only"`                       // 是否仅限房主、管理员与受邀成员加入
+	UpdatedAt  time.Time `json:"updated_at"`                        // 修改时间
+}
+
+func (RoomSetting) TableName() string {
+	return "websocket_room_setting"
+}
+
+// RoomRole 房间角色，只有鉴权用户可以拥有角色
+type RoomRole struct {
+	Room      string    `gorm:"primaryKey;size:128" json:"room"`                  // 房间名
+	User      string    `gorm:"column:user_name;primaryKey;size:128" json:"user"` // 鉴权用户的 uid
+	Role      string    `gorm:"size:16" json:"role"`                              // 角色，为空表示取消角色
+	UpdatedAt time.Time `json:"updated_at"`                                       // 修改时间
+}
+
+func (RoomRole) TableName() string {
+	return "websocket_room_role"
+}
+
+// RoomSanction 房间处罚记录
+type RoomSanction struct {
+	Id        int64      `gorm:"primaryKey;autoIncrement" json:"id"`              // 记录标识
+	Room      string     `gorm:"size:128;index" json:"room"`                      // 房间名
+	Kind      string     `gorm:"size:16" json:"kind"`                             // 处罚类型：ban、mute
+	User      string     `gorm:"column:user_name;size:128" json:"user,omitempty"` // 处罚用户
+	Ip        string     `gorm:"size:64" json:"ip,omitempty"`                     // 封禁地址
+	Operator  string     `gorm:"size:128" json:"operator"`                        // 操作用户
+	Reason    string     `gorm:"size:255" json:"reason,omitempty"`                // 原因
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`               // 到期时间，为空时永久有效
+	CreatedAt time.Time  `json:"created_at"`                                      // 创建时间
+}
+
+func (RoomSanction) TableName() string {
+	return "websocket_room_sanction"
+}
+
+// active 处罚在 now 时是否有效
+func (s *RoomSanction) active(now time.Time) bool {
+	return s.ExpiresAt == nil || s.ExpiresAt.After(now)
+}
+
+// match 处罚是否作用于该用户或地址
+func (s *RoomSanction) match(user string, ip string) bool {
+	return (s.User != "" && s.User == user) || (s.Ip != "" && s.Ip == ip)
+}
+
+// ModerationStore 房间管理数据存储
+type ModerationStore interface {
+	// LoadRoom 加载房间设置、角色与未过期的处罚，房间未设置过时 setting 为空
+	LoadRoom(room string) (setting *RoomSetting, roles []RoomRole, sanctions []RoomSanction, err error)
+	// SaveSetting 保存房间设置
+	SaveSetting(setting *RoomSetting) error
+	// SaveRole 保存房间角色，Role 为空时删除
+	SaveRole(role *RoomRole) error
+	// AddSanction 添加处罚记录
+	AddSanction(sanction *RoomSanction) error
+	// RemoveSanctions 删除房间中该类型、用户与地址的处罚，user、ip 为空时不参与匹配
+	RemoveSanctions(room string, kind string, user string, ip string) error
+}
+
+// GormModerationStore 基于 gorm 的房间管理数据存储
+type GormModerationStore struct {
+	db *gorm.DB
+}
+
+// NewGormModerationStore 创建房间管理数据存储并迁移数据表
+func NewGormModerationStore(db *databases.GormDB) (*GormModerationStore, error) {
+	if err := db.AutoMigrate(&RoomSetting{}, &RoomRole{}, &RoomSanction{}); err != nil {
+		return nil, err
+	}
+	return &GormModerationStore{db: db.GetDBClient()}, nil
+}
+
+func (s *GormModerationStore) LoadRoom(room string) (setting *RoomSetting, roles []RoomRole, sanctions []RoomSanction, err error) {
+	var settings []RoomSetting
+	if err = s.db.Where("room = ?", room).Limit(1).Find(&settings).Error; err != nil {
+		return
+	}
+	if len(settings) > 0 {
+		setting = &settings[0]
+	}
+	if err = s.db.Where("room = ?", room).Find(&roles).Error; err != nil {
+		return
+	}
+	err = s.db.Where("room = ? AND (expires_at IS NULL OR expires_at > ?)", room, time.Now()).Find(&sanctions).Error
+	return
+}
+
+func (s *GormModerationStore) SaveSetting(setting *RoomSetting) error {
+	return s.db.Save(setting).Error
+}
+
+func (s *GormModerationStore) SaveRole(role *RoomRole) error {
+	if role.Role == "" {
+		return s.db.Where("room = ? AND user_name = ?", role.Room, role.User).Delete(&RoomRole{}).Error
+	}
+	return s.db.Save(role).Error
+}
+
+func (s *GormModerationStore) AddSanction(sanction *RoomSanction) error {
+	return s.db.Create(sanction).Error
+}
+
+func (s *GormModerationStore) RemoveSanctions(room string, kind string, user string, ip string) error {
+	tx := s.db.Where("room = ? AND kind = ?", room, kind)
+	if user != "" {
+		tx = tx.Where("user_name = ?", user)
+	}
+	if ip != "" {
+		tx = tx.Where("ip = ?", ip)
+	}
+	return tx.Delete(&RoomSanction{}).Error
+}
+
+// hashPassword 计算房间密码的 bcrypt 摘要，耗时较长，不应在房间协程内调用
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// checkPassword 校验房间密码，耗时较长，不应在房间协程内调用
+func checkPassword(hash string, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// passwordCheck 房间设置了密码且尚未校验，由 admit 返回，调用方在房间协程外校验密码后携带已校验的摘要重试
+type passwordCheck struct {
+	hash string
+}
+
+func (e *passwordCheck) Error() string {
+	return "room password check required"
+}
+
+// roleRank 角色等级，用于判断管理权限
+func roleRank(role string) int {
+	switch role {
+	case RoleOwner:
+		return 3
+	case RoleModerator:
+		return 2
+	case RoleMember:
+		return 1
+	}
+	return 0
+}
+
+// roomPolicy 房间设置、角色与处罚，仅在房间协程内读写
+type roomPolicy struct {
+	setting   RoomSetting
+	roles     map[string]string
+	sanctions []RoomSanction
+}
+
+func newRoomPolicy(room string) *roomPolicy {
+	return &roomPolicy{setting: RoomSetting{Room: room}, roles: make(map[string]string)}
+}
+
+// owner 房主，没有房主时返回空
+func (p *roomPolicy) owner() string {
+	for user, role := range p.roles {
+		if role == RoleOwner {
+			return user
+		}
+	}
+	return ""
+}
+
+// sanctioned 查找作用于该用户或地址的有效处罚，同时清理已过期的处罚
+func (p *roomPolicy) sanctioned(kind string, user string, ip string, now time.Time) *RoomSanction {
+	var found *RoomSanction
+	sanctions := p.sanctions[:0]
+	for i := range p.sanctions {
+		s := p.sanctions[i]
+		if !s.active(now) {
+			continue
+		}
+		sanctions = append(sanctions, s)
+		if found == nil && s.Kind == kind && s.match(user, ip) {
+			found = &s
+		}
+	}
+	p.sanctions = sanctions
+	return found
+}
+
+// removeSanctions 删除该类型、用户与地址的处罚
+func (p *roomPolicy) removeSanctions(kind string, user string, ip string) {
+	sanctions := p.sanctions[:0]
+	for _, s := range p.sanctions {
+		if s.Kind == kind && (user == "" || s.User == user) && (ip == "" || s.Ip == ip) {
+			continue
+		}
+		sanctions = append(sanctions, s)
+	}
+	p.sanctions = sanctions
+}
+
+// SystemPayload 系统消息内容
+type SystemPayload struct {
+	Action   string `json:"action,omitempty"`   // 管理操作
+	User     string `json:"user,omitempty"`     // 目标用户
+	Operator string `json:"operator,omitempty"` // 操作用户
+	Role     string `json:"role,omitempty"`     // 设置的角色
+	Reason   string `json:"reason,omitempty"`   // 原因
+	Until    int64  `json:"until,omitempty"`    // 禁言、封禁到期时间（毫秒），为 0 时永久
+	Content  string `json:"content"`            // 展示文本
+}
+
+// moderation 管理操作产生的状态变更，在各节点的房间协程内执行
+type moderation struct {
+	Event    *SystemPayload `json:"event"`
+	Setting  *RoomSetting   `json:"setting,omitempty"`   // 修改后的房间设置
+	Roles    []RoomRole     `json:"roles,omitempty"`     // 修改的角色
+	Sanction *RoomSanction  `json:"sanction,omitempty"`  // 新增的处罚
+	Remove   *RoomSanction  `json:"remove,omitempty"`    // 解除的处罚，按类型、用户与地址匹配
+	KickUser string         `json:"kick_user,omitempty"` // 移出房间的用户
+	KickIp   string         `json:"kick_ip,omitempty"`   // 移出房间的地址
+}
+
+// save 持久化状态变更
+func (m *moderation) save(store ModerationStore) error {
+	if m.Setting != nil {
+		if err := store.SaveSetting(m.Setting); err != nil {
+			return err
+		}
+	}
+	for i := range m.Roles {
+		if err := store.SaveRole(&m.Roles[i]); err != nil {
+			return err
+		}
+	}
+	if m.Sanction != nil {
+		if err := store.AddSanction(m.Sanction); err != nil {
+			return err
+		}
+	}
+	if m.Remove != nil {
+		return store.RemoveSanctions(m.Remove.Room, m.Remove.Kind, m.Remove.User, m.Remove.Ip)
+	}
+	return nil
+}
+
+// loadPolicy 从存储中加载房间设置，在房间协程启动时调用
+func (h *hub) loadPolicy() {
+	h.policy = newRoomPolicy(h.name)
+	store := h.manager.moderation
+	if store == nil {
+		return
+	}
+	setting, roles, sanctions, err := store.LoadRoom(h.name)
+	if err != nil {
+		h.manager.logger.Logger.Error(err.Error(), zap.String("room", h.name))
+		return
+	}
+	if setting != nil {
+		h.policy.setting = *setting
+	}
+	for _, role := range roles {
+		h.policy.roles[role.User] = role.Role
+	}
+	h.policy.sanctions = sanctions
+}
+
+// admit 校验入房权限后加入房间，房间没有房主时首个加入的鉴权用户成为房主并返回该角色，仅在房间协程内调用
+// verified 为调用方已校验通过的密码摘要，与当前房间密码不一致时返回 *passwordCheck
+func (h *hub) admit(c *connection, verified string) (*RoomRole, error) {
+	p := h.policy
+	if p.sanctioned(sanctionBan, c.user, c.ip, time.Now()) != nil {
+		return nil, newProtocolError(CodeBanned, "banned from room")
+	}
+	role := h.role(c)
+	if roleRank(role) < roleRank(RoleModerator) {
+		if p.setting.InviteOnly && role != RoleMember {
+			return nil, newProtocolError(CodeInviteOnly, "room is invite only")
+		}
+		if p.setting.Password != "" && p.setting.Password != verified {
+			return nil, &passwordCheck{hash: p.setting.Password}
+		}
+	}
+	if h.nameTaken(c) {
+		return nil, newProtocolError(CodeNameTaken, "name already in use")
+	}
+	var owner *RoomRole
+	if c.uid != 0 && p.owner() == "" {
+		p.roles[c.user] = RoleOwner
+		owner = &RoomRole{Room: h.name, User: c.user, Role: RoleOwner, UpdatedAt: time.Now()}
+	}
+	h.addMember(c)
+	return owner, nil
+}
+
+// role 连接所属用户在房间内的角色，匿名用户没有角色，仅在房间协程内调用
+func (h *hub) role(c *connection) string {
+	if c.uid == 0 {
+		return ""
+	}
+	return h.policy.roles[c.user]
+}
+
+// muted 用户是否被禁言，仅在房间协程内调用
+func (h *hub) muted(c *connection) bool {
+	return h.policy.sanctioned(sanctionMute, c.user, "", time.Now()) != nil
+}
+
+// moderate 校验操作权限并生成状态变更，仅在房间协程内调用
+func (h *hub) moderate(c *connection, payload *ModeratePayload, now time.Time) (*moderation, error) {
+	p := h.policy
+	operator := c.user
+	rank := roleRank(h.role(c))
+	if rank < roleRank(RoleModerator) {
+		return nil, newProtocolError(CodePermissionDenied, "permission denied")
+	}
+	target := payload.User
+	// 只能管理角色低于自己的用户
+	if target != "" && roleRank(p.roles[target]) >= rank {
+		return nil, newProtocolError(CodePermissionDenied, "permission denied")
+	}
+	event := &SystemPayload{Action: payload.Action, User: target, Operator: operator, Reason: payload.Reason}
+	m := &moderation{Event: event}
+	var expiresAt *time.Time
+	if payload.Duration > 0 {
+		t := now.Add(time.Duration(payload.Duration) * time.Second)
+		expiresAt = &t
+		event.Until = t.UnixMilli()
+	}
+	sanction := func(kind string, ip string) *RoomSanction {
+		return &RoomSanction{Room: h.name, Kind: kind, User: target, Ip: ip, Operator: operator,
+			Reason: payload.Reason, ExpiresAt: expiresAt, CreatedAt: now}
+	}
+	switch payload.Action {
+	case ActionKick:
+		if target == "" {
+			return nil, newProtocolError(CodeInvalidPayload, "user required")
+		}
+		m.KickUser = target
+		event.Content = fmt.Sprintf("%s was kicked by %s", target, operator)
+	case ActionMute:
+		if target == "" {
+			return nil, newProtocolError(CodeInvalidPayload, "user required")
+		}
+		m.Sanction = sanction(sanctionMute, "")
+		event.Content = fmt.Sprintf("%s was muted by %s", target, operator)
+	case ActionUnmute:
+		if target == "" {
+			return nil, newProtocolError(CodeInvalidPayload, "user required")
+		}
+		m.Remove = &RoomSanction{Room: h.name, Kind: sanctionMute, User: target}
+		event.Content = fmt.Sprintf("%s was unmuted by %s", target, operator)
+	case ActionBan:
+		if target == "" && payload.Ip == "" {
+			return nil, newProtocolError(CodeInvalidPayload, "user or ip required")
+		}
+		// 匿名用户可以随意更换用户名，同时封禁其当前地址，但只移出该用户
+		ip := payload.Ip
+		if ip == "" && target != "" && !numeric(target) {
+			ip = h.memberIp(target)
+		}
+		m.Sanction = sanction(sanctionBan, ip)
+		m.KickUser, m.KickIp = target, payload.Ip
+		event.Content = fmt.Sprintf("%s was banned by %s", target, operator)
+		if target == "" {
+			event.Content = fmt.Sprintf("an address was banned by %s", operator)
+		}
+	case ActionUnban:
+		if target == "" && payload.Ip == "" {
+			return nil, newProtocolError(CodeInvalidPayload, "user or ip required")
+		}
+		m.Remove = &RoomSanction{Room: h.name, Kind: sanctionBan, User: target, Ip: payload.Ip}
+		event.Content = fmt.Sprintf("%s was unbanned by %s", target, operator)
+		if target == "" {
+			event.Content = fmt.Sprintf("an address was unbanned by %s", operator)
+		}
+	case ActionRole:
+		if !numeric(target) {
+			return nil, newProtocolError(CodeInvalidPayload, "roles can only be granted to authenticated users")
+		}
+		role := payload.Role
+		switch role {
+		case "", RoleMember:
+		case RoleModerator, RoleOwner:
+			if rank < roleRank(RoleOwner) {
+				return nil, newProtocolError(CodePermissionDenied, "permission denied")
+			}
+		default:
+			return nil, newProtocolError(CodeInvalidPayload, fmt.Sprintf("unknown role %q", role))
+		}
+		m.Roles = append(m.Roles, RoomRole{Room: h.name, User: target, Role: role, UpdatedAt: now})
+		// 转让房主后原房主成为管理员
+		if role == RoleOwner {
+			m.Roles = append(m.Roles, RoomRole{Room: h.name, User: operator, Role: RoleModerator, UpdatedAt: now})
+		}
+		event.Role = role
+		event.Content = fmt.Sprintf("%s set %s as %s", operator, target, role)
+		if role == "" {
+			event.Content = fmt.Sprintf("%s removed the role of %s", operator, target)
+		}
+	case ActionSettings:
+		if rank < roleRank(RoleOwner) {
+			return nil, newProtocolError(CodePermissionDenied, "permission denied")
+		}
+		setting := p.setting
+		if payload.Password != nil {
+			// 密码已由调用方在房间协程外计算摘要
+			setting.Password = *payload.Password
+		}
+		if payload.InviteOnly != nil {
+			setting.InviteOnly = *payload.InviteOnly
+		}
+		setting.UpdatedAt = now
+		m.Setting = &setting
+		event.User, event.Reason = "", ""
+		event.Content = fmt.Sprintf("room settings were updated by %s", operator)
+	default:
+		return nil, newProtocolError(CodeInvalidPayload, fmt.Sprintf("unknown action %q", payload.Action))
+	}
+	return m, nil
+}
+
+// apply 执行状态变更，向被移出的连接单独发送系统消息后关闭连接，仅在房间协程内调用
+func (h *hub) apply(m *moderation, data []byte) {
+	p := h.policy
+	if m.Setting != nil {
+		p.setting = *m.Setting
+	}
+	for _, role := range m.Roles {
+		if role.Role == "" {
+			delete(p.roles, role.User)
+		} else {
+			p.roles[role.User] = role.Role
+		}
+	}
+	if m.Sanction != nil {
+		p.sanctions = append(p.sanctions, *m.Sanction)
+	}
+	if m.Remove != nil {
+		p.removeSanctions(m.Remove.Kind, m.Remove.User, m.Remove.Ip)
+	}
+	if m.KickUser == "" && m.KickIp == "" {
+		return
+	}
+	kick := &RoomSanction{User: m.KickUser, Ip: m.KickIp}
+	for c := range h.c {
+		if !kick.match(c.user, c.ip) {
+			continue
+		}
+		h.removeMember(c)
+		c.trySend(data)
+		c.close(CloseKicked, m.Event.Action)
+	}
+}
+
+// memberIp 房间内该用户的连接地址，用户不在房间内时返回空，仅在房间协程内调用
+func (h *hub) memberIp(user string) string {
+	for c := range h.c {
+		if c.user == user {
+			return c.ip
+		}
+	}
+	return ""
+}
+
+// moderate 处理客户端的房间管理消息
+func (c *connection) moderate(payload *ModeratePayload) error {
+	h := c.hub
+	if h == nil {
+		return newProtocolError(CodeNotLoggedIn, "not logged in")
+	}
+	if payload.Action == ActionSettings && payload.Password != nil && *payload.Password != "" {
+		hash, err := hashPassword(*payload.Password)
+		if err != nil {
+			return newProtocolError(CodeInvalidPayload, err.Error())
+		}
+		payload.Password = &hash
+	}
+	var (
+		m    *moderation
+		data []byte
+		err  error
+	)
+	h.call(func() {
+		if m, err = h.moderate(c, payload, time.Now()); err != nil {
+			return
+		}
+		env := NewEnvelope(TypeSystem, m.Event)
+		env.Room, env.Uid, env.From = h.name, c.uid, c.user
+		data = env.encode()
+		h.apply(m, data)
+	})
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return newProtocolError(CodeNotLoggedIn, "not logged in")
+	}
+	h.manager.moderated(h, m, data)
+	return nil
+}
+
+// moderated 持久化状态变更并向房间广播系统消息，启用多节点总线时同步到其他节点
+func (m *roomManager) moderated(h *hub, mod *moderation, data []byte) {
+	if store := m.moderation; store != nil {
+		if err := mod.save(store); err != nil {
+			m.logger.Logger.Error(err.Error(), zap.String("room", h.name))
+		}
+	}
+	h.broadcast(0, data)
+	if bp := m.backplane; bp != nil {
+		bp.moderate(h.name, mod, data)
+	}
+}
+
+// SetRoomRole 设置房间角色，user 为鉴权用户的 uid，role 为空时取消角色，房间不存在时仅保存到存储中
+func (s *Server) SetRoomRole(room string, user string, role string) error {
+	if roleRank(role) == 0 && role != "" {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	if !numeric(user) {
+		return fmt.Errorf("user %q is not a uid", user)
+	}
+	now := time.Now()
+	m := &moderation{
+		Event: &SystemPayload{Action: ActionRole, User: user, Role: role,
+			Content: fmt.Sprintf("%s was set as %s", user, role)},
+		Roles: []RoomRole{{Room: room, User: user, Role: role, UpdatedAt: now}},
+	}
+	if role == "" {
+		m.Event.Content = fmt.Sprintf("the role of %s was removed", user)
+	}
+	h := s.rooms.get(room)
+	if h == nil {
+		if s.rooms.moderation == nil {
+			return ErrRoomNotFound
+		}
+		return m.save(s.rooms.moderation)
+	}
+	env := NewEnvelope(TypeSystem, m.Event)
+	env.Room = room
+	data := env.encode()
+	h.call(func() {
+		// 设置新房主时原房主成为管理员
+		if owner := h.policy.owner(); role == RoleOwner && owner != "" && owner != user {
+			m.Roles = append(m.Roles, RoomRole{Room: room, User: owner, Role: RoleModerator, UpdatedAt: now})
+		}
+		h.apply(m, data)
+	})
+	s.rooms.moderated(h, m, data)
+	return nil
+}
@@ -0,0 +1,174 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  origin
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 4:40 下午
+ */
+
+package websocket
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var ErrOriginNotAllowed = errors.New("origin not allowed")
+
+// originPolicy 来源白名单
+type originPolicy struct {
+	any       bool            // 允许所有来源
+	null      bool            // 允许本地文件等不透明来源，其 Origin 为 null
+	origins   map[string]bool // scheme://host[:port]
+	hosts     map[string]bool // 含端口的 host:port
+	hostnames map[string]bool // 不含端口的 host，匹配任意端口
+	suffixes  []string        // 通配子域名的后缀，如 .example.com
+}
+
+// newOriginPolicy 解析来源白名单，allowed 为空时返回 nil 表示只允许同源
+func newOriginPolicy(allowed []string) *originPolicy {
+	if len(allowed) == 0 {
+		return nil
+	}
+	p := &originPolicy{origins: make(map[string]bool), hosts: make(map[string]bool), hostnames: make(map[string]bool)}
+	for _, origin := range allowed {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			p.any = true
+		case origin == "null":
+			p.null = true
+		case strings.Contains(origin, "://"):
+			p.origins[strings.TrimSuffix(origin, "/")] = true
+		case strings.HasPrefix(origin, "*."):
+			p.suffixes = append(p.suffixes, origin[1:])
+		case strings.Contains(origin, ":"):
+			p.hosts[origin] = true
+		case origin != "":
+			p.hostnames[origin] = true
+		}
+	}
+	return p
+}
+
+// allow 来源是否在白名单中
+func (p *originPolicy) allow(u *url.URL) bool {
+	if p.any {
+		return true
+	}
+	host := strings.ToLower(u.Host)
+	hostname := strings.ToLower(u.Hostname())
+	if p.origins[strings.ToLower(u.Scheme)+"://"+host] || p.hosts[host] || p.hostnames[hostname] {
+		return true
+	}
+	for _, suffix := range p.suffixes {
+		if strings.HasSuffix(hostname, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin 检查握手请求的来源，未携带 Origin 的非浏览器客户端直接放行，未配置白名单时只允许同源
+func (s *Server) checkOrigin(r *http.Request) bool {
+	if s.config.CheckOrigin != nil {
+		return s.config.CheckOrigin(r)
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if origin == "null" {
+		return s.origins != nil && (s.origins.any || s.origins.null)
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if s.origins == nil {
+		return strings.EqualFold(u.Host, r.Host)
+	}
+	return s.origins.allow(u)
+}
+
+// parseTrustedProxies 解析可信代理列表，单个 ip 视为只包含该地址的网段
+func parseTrustedProxies(proxies []string) (nets []*net.IPNet, invalid []string) {
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			invalid = append(invalid, proxy)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, invalid
+}
+
+// trusted 地址是否为可信代理
+func (s *Server) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range s.proxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP 获取客户端地址，请求来自可信代理时从 X-Forwarded-For 由右向左取第一个非可信代理的地址，
+// 没有 X-Forwarded-For 时使用 X-Real-IP，用于握手消息、房间封禁与限流
+func (s *Server) clientIP(r *http.Request) string {
+	ip := remoteHost(r)
+	if !s.trusted(ip) {
+		return ip
+	}
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(header, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(addr))
+		}
+	}
+	if len(forwarded) == 0 {
+		if realIp := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIp) != nil {
+			return realIp
+		}
+		return ip
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		// 无法解析的地址之前的内容均不可信
+		if net.ParseIP(forwarded[i]) == nil {
+			break
+		}
+		ip = forwarded[i]
+		if !s.trusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// remoteHost 请求地址中的 ip 部分
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,113 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  presence
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 7:30 下午
+ */
+
+package websocket
+
+import (
+	"strconv"
+)
+
+// 在线状态
+const (
+	StatusOnline = "online" // 在线
+	StatusAway   = "away"   // 离开
+	StatusBusy   = "busy"   // 忙碌
+)
+
+// RoomUser 房间用户，同一用户的多个连接只出现一次
+type RoomUser struct {
+	Id      string `json:"id"`            // 用户标识，与消息中的 from 一致，鉴权用户为 uid，匿名用户为用户名
+	Uid     int64  `json:"uid,omitempty"` // 鉴权用户的 uid
+	Name    string `json:"name"`          // 显示名称，房间内唯一
+	Status  string `json:"status"`        // 在线状态
+	Devices int    `json:"devices"`       // 在房间内的连接数
+	Bot     bool   `json:"bot,omitempty"` // 是否为进程内机器人
+}
+
+// PresencePayload 设置在线状态消息内容，服务端广播的在线状态消息内容为 RoomUser
+type PresencePayload struct {
+	Status string `json:"status"` // online、away 或 busy
+}
+
+// key 用户在房间内的身份，鉴权用户按 uid 区分，匿名用户按用户名区分，机器人与用户互不冲突
+func (u *RoomUser) key() string {
+	if u.Bot {
+		return "bot:" + u.Id
+	}
+	return userKey(u.Uid, u.Id)
+}
+
+func userKey(uid int64, user string) string {
+	if uid != 0 {
+		return "uid:" + strconv.FormatInt(uid, 10)
+	}
+	return "name:" + user
+}
+
+// presenceKey 连接所属用户在房间内的身份
+func (c *connection) presenceKey() string {
+	return userKey(c.uid, c.user)
+}
+
+// users 房间用户列表快照，按首次加入顺序排列，仅在房间协程内调用
+func (h *hub) users() []*RoomUser {
+	users := make([]*RoomUser, 0, len(h.order))
+	for _, key := range h.order {
+		u := *h.presence[key]
+		users = append(users, &u)
+	}
+	return users
+}
+
+// nameTaken 显示名称或用户标识是否已被房间内的其他用户使用，仅在房间协程内调用
+func (h *hub) nameTaken(c *connection) bool {
+	key := c.presenceKey()
+	for k, u := range h.presence {
+		if k != key && (u.Name == c.name || u.Id == c.user) {
+			return true
+		}
+	}
+	return false
+}
+
+// setStatus 设置用户在线状态，状态未变化时返回 nil，仅在房间协程内调用
+func (h *hub) setStatus(c *connection, status string) *RoomUser {
+	u := h.presence[c.presenceKey()]
+	if u == nil || u.Status == status {
+		return nil
+	}
+	u.Status = status
+	if bp := h.manager.backplane; bp != nil {
+		room, users := h.name, h.users()
+		bp.enqueue(func() { bp.savePresence(room, users) })
+	}
+	user := *u
+	return &user
+}
+
+// presence 处理设置在线状态消息，状态变化时向房间广播，同一用户的所有连接共享状态
+func (c *connection) presence(payload *PresencePayload) error {
+	h := c.hub
+	if h == nil {
+		return newProtocolError(CodeNotLoggedIn, "not logged in")
+	}
+	switch payload.Status {
+	case StatusOnline, StatusAway, StatusBusy:
+	default:
+		return newProtocolError(CodeInvalidPayload, "unknown status "+strconv.Quote(payload.Status))
+	}
+	var user *RoomUser
+	h.call(func() { user = h.setStatus(c, payload.Status) })
+	if user == nil {
+		return nil
+	}
+	env := NewEnvelope(TypePresence, user)
+	env.Room, env.Uid, env.From = c.room, c.uid, c.user
+	h.publish(0, env.encode())
+	return nil
+}
@@ -0,0 +1,180 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  protocol
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 8:40 下午
+ */
+
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ProtocolVersion 当前协议版本
+const ProtocolVersion = 1
+
+// 消息类型
+const (
+	TypeHandshake = "handshake"  // 服务端：握手
+	TypeLogin     = "login"      // 客户端：登录房间；服务端：用户上线
+	TypeLogout    = "logout"     // 客户端：退出房间；服务端：用户下线
+	TypeUser      = "user"       // 房间消息
+	TypeDirect    = "direct"     // 私聊消息
+	TypeRefresh   = "refresh"    // 客户端：刷新 token
+	TypeResume    = "resume"     // 客户端：断线重连后恢复会话；服务端：恢复成功后的房间用户列表
+	TypeModerate  = "moderate"   // 客户端：房间管理操作
+	TypeSystem    = "system"     // 服务端：系统消息
+	TypeInbox     = "inbox"      // 服务端：收件箱消息与未读数
+	TypeInboxRead = "inbox_read" // 客户端：标记收件箱消息已读
+	TypeTyping    = "typing"     // 正在输入状态，To 不为空时只发给该用户
+	TypeRead      = "read"       // 已读回执，客户端通过 To 指定消息发送方
+	TypeRecall    = "recall"     // 客户端：撤回消息；服务端：消息已被撤回
+	TypePresence  = "presence"   // 客户端：设置在线状态；服务端：用户在线状态变化
+	TypeAck       = "ack"        // 服务端：消息处理成功
+	TypeNack      = "nack"       // 服务端：消息处理失败
+)
+
+// 错误码
+const (
+	CodeMalformedMessage   = 40001 // 消息格式错误
+	CodeUnsupportedVersion = 40002 // 不支持的协议版本
+	CodeUnknownType        = 40003 // 未知消息类型
+	CodeInvalidPayload     = 40004 // 消息内容格式错误
+	CodeContentRejected    = 40005 // 消息内容未通过过滤
+	CodeNotLoggedIn        = 40101 // 未登录房间
+	CodeInvalidToken       = 40102 // token 无效
+	CodeBanned             = 40301 // 已被房间封禁
+	CodeInviteOnly         = 40302 // 房间仅限邀请加入
+	CodeWrongPassword      = 40303 // 房间密码错误
+	CodeMuted              = 40304 // 已被禁言
+	CodePermissionDenied   = 40305 // 没有管理权限
+	CodeRecallDenied       = 40306 // 消息不存在、不是自己发送的或已超过撤回时限
+	CodeUserOffline        = 40401 // 接收用户不在线
+	CodeSessionExpired     = 40402 // 会话不存在或已过期
+	CodeRoomNotFound       = 40403 // 房间不存在
+	CodeNameTaken          = 40901 // 显示名称已被房间内其他用户使用
+	CodeRateLimited        = 42901 // 消息频率超出限制
+	CodeInternalError      = 50001 // 服务端内部错误
+)
+
+// Envelope 消息信封，消息内容按类型放在 Payload 中
+type Envelope struct {
+	V       int               `json:"v"`                 // 协议版本
+	Id      string            `json:"id,omitempty"`      // 客户端消息标识，服务端在 ack/nack 中原样返回，并据此忽略重复提交
+	Seq     int64             `json:"seq,omitempty"`     // 服务端分配的房间内消息序号
+	Ts      int64             `json:"ts,omitempty"`      // 服务端时间戳（毫秒）
+	Type    string            `json:"type"`              // 消息类型
+	Room    string            `json:"room,omitempty"`    // 房间名
+	Uid     int64             `json:"uid,omitempty"`     // 发送用户 uid
+	From    string            `json:"from,omitempty"`    // 发送用户
+	To      string            `json:"to,omitempty"`      // 私聊接收用户
+	Payload json.RawMessage   `json:"payload,omitempty"` // 消息内容
+	Meta    map[string]string `json:"meta,omitempty"`    // 扩展字段，由服务端钩子填充，客户端提交的值会被忽略
+}
+
+// HandshakePayload 握手消息内容
+type HandshakePayload struct {
+	Ip      string `json:"ip"`                // 客户端地址
+	Uid     int64  `json:"uid,omitempty"`     // 鉴权连接的用户 uid
+	Session string `json:"session,omitempty"` // 会话标识，断线重连后用于恢复会话，未启用会话恢复时为空
+	Conn    string `json:"conn,omitempty"`    // HTTP 传输的连接标识，发送消息与轮询时携带，websocket 连接为空
+}
+
+// LoginPayload 登录消息内容
+type LoginPayload struct {
+	Name     string `json:"name"`               // 用户名，鉴权连接的用户名固定为 uid，该字段作为显示名称
+	Seq      int64  `json:"seq,omitempty"`      // 客户端已收到的最后一条消息序号，用于补发聊天记录
+	Password string `json:"password,omitempty"` // 房间密码
+}
+
+// ResumePayload 恢复会话消息内容
+type ResumePayload struct {
+	Session string `json:"session"`       // 握手时下发的会话标识
+	Seq     int64  `json:"seq,omitempty"` // 客户端已收到的最后一条消息序号，恢复后补发该序号之后的房间消息
+}
+
+// MemberPayload 用户上下线消息内容
+type MemberPayload struct {
+	User     string      `json:"user"`           // 上下线的用户
+	Name     string      `json:"name,omitempty"` // 上下线用户的显示名称
+	Uid      int64       `json:"uid,omitempty"`  // 上下线用户的 uid
+	Ip       string      `json:"ip,omitempty"`   // 上下线用户的地址
+	UserList []*RoomUser `json:"user_list"`      // 房间当前用户列表
+}
+
+// TextPayload 文本消息内容
+type TextPayload struct {
+	Content string `json:"content"`
+}
+
+// RefreshPayload 刷新 token 消息内容
+type RefreshPayload struct {
+	Token string `json:"token"`
+}
+
+// ModeratePayload 房间管理消息内容
+type ModeratePayload struct {
+	Action     string  `json:"action"`                // 管理操作
+	User       string  `json:"user,omitempty"`        // 目标用户
+	Ip         string  `json:"ip,omitempty"`          // 封禁地址
+	Duration   int64   `json:"duration,omitempty"`    // 禁言、封禁时长（秒），为 0 时永久
+	Reason     string  `json:"reason,omitempty"`      // 原因
+	Role       string  `json:"role,omitempty"`        // 设置的角色，为空时取消角色
+	Password   *string `json:"password,omitempty"`    // 房间密码，空字符串表示取消密码
+	InviteOnly *bool   `json:"invite_only,omitempty"` // 是否仅限邀请
+}
+
+// NackPayload 消息处理失败原因
+type NackPayload struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// ProtocolError 协议错误，以 nack 回复客户端
+type ProtocolError struct {
+	Code    int
+	Message string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+func newProtocolError(code int, message string) *ProtocolError {
+	return &ProtocolError{Code: code, Message: message}
+}
+
+// NewEnvelope 创建当前协议版本的消息
+func NewEnvelope(typ string, payload interface{}) *Envelope {
+	env := &Envelope{V: ProtocolVersion, Type: typ, Ts: time.Now().UnixMilli()}
+	if payload != nil {
+		env.SetPayload(payload)
+	}
+	return env
+}
+
+// SetPayload 设置消息内容
+func (e *Envelope) SetPayload(payload interface{}) {
+	e.Payload, _ = json.Marshal(payload)
+}
+
+// DecodePayload 解析消息内容
+func (e *Envelope) DecodePayload(payload interface{}) error {
+	if len(e.Payload) == 0 {
+		return newProtocolError(CodeInvalidPayload, "payload required")
+	}
+	if err := json.Unmarshal(e.Payload, payload); err != nil {
+		return newProtocolError(CodeInvalidPayload, err.Error())
+	}
+	return nil
+}
+
+// encode 编码消息
+func (e *Envelope) encode() []byte {
+	data_b, _ := json.Marshal(e)
+	return data_b
+}
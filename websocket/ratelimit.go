@@ -0,0 +1,282 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  ratelimit
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 10:05 上午
+ */
+
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultViolationWindow = 10 * time.Second
+	defaultMuteDuration    = 30 * time.Second
+	// bucketSweepSize 共享令牌桶数量超过该值时清理已回满的令牌桶
+	bucketSweepSize = 1024
+)
+
+// RateLimitConfig 限流配置，速率为 0 的项不限制
+type RateLimitConfig struct {
+	MessagesPerSecond     float64       // 每个连接每秒消息数
+	MessageBurst          int           // 每个连接允许的突发消息数，默认与每秒消息数相同
+	BytesPerSecond        float64       // 每个连接每秒字节数
+	ByteBurst             int           // 每个连接允许的突发字节数，默认取每秒字节数与 MaxMessageSize 中的较大值
+	UserMessagesPerSecond float64       // 每个用户所有连接合计每秒消息数
+	UserBurst             int           // 每个用户允许的突发消息数，默认与每秒消息数相同
+	IpMessagesPerSecond   float64       // 每个地址所有连接合计每秒消息数
+	IpBurst               int           // 每个地址允许的突发消息数，默认与每秒消息数相同
+	MaxConnectionsPerIp   int           // 每个地址的最大并发连接数，为 0 时不限制
+	ViolationWindow       time.Duration // 违规次数统计窗口，默认 10 秒
+	MuteAfter             int           // 窗口内违规次数达到该值后临时禁言，为 0 时不禁言
+	MuteDuration          time.Duration // 临时禁言时长，默认 30 秒
+	DisconnectAfter       int           // 窗口内违规次数达到该值后断开连接，为 0 时不断开
+}
+
+// RateLimitStats 限流计数
+type RateLimitStats struct {
+	Limited             uint64 `json:"limited"`              // 被拒绝的消息数
+	Mutes               uint64 `json:"mutes"`                // 临时禁言次数
+	Disconnects         uint64 `json:"disconnects"`          // 因违规断开的连接数
+	RejectedConnections uint64 `json:"rejected_connections"` // 因地址连接数超限被拒绝的连接数
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	b := float64(burst)
+	if b < 1 {
+		b = rate
+	}
+	if b < 1 {
+		b = 1
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: now}
+}
+
+// refill 按经过的时间补充令牌
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// allow 取出 n 个令牌，令牌不足时返回 false
+func (b *tokenBucket) allow(n float64, now time.Time) bool {
+	b.refill(now)
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// bucketGroup 按 key 共享的令牌桶
+type bucketGroup struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newBucketGroup(rate float64, burst int) *bucketGroup {
+	if rate <= 0 {
+		return nil
+	}
+	return &bucketGroup{rate: rate, burst: burst, buckets: make(map[string]*tokenBucket)}
+}
+
+// allow 从 key 对应的令牌桶中取出一个令牌
+func (g *bucketGroup) allow(key string, now time.Time) bool {
+	if g == nil || key == "" {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	b := g.buckets[key]
+	if b == nil {
+		if len(g.buckets) >= bucketSweepSize {
+			g.sweep(now)
+		}
+		b = newTokenBucket(g.rate, g.burst, now)
+		g.buckets[key] = b
+	}
+	return b.allow(1, now)
+}
+
+// sweep 删除已回满的令牌桶，回满的令牌桶与新建的等价
+func (g *bucketGroup) sweep(now time.Time) {
+	for key, b := range g.buckets {
+		if b.refill(now); b.tokens >= b.burst {
+			delete(g.buckets, key)
+		}
+	}
+}
+
+// rateLimiter 服务级限流状态
+type rateLimiter struct {
+	config *RateLimitConfig
+	users  *bucketGroup
+	ips    *bucketGroup
+
+	mu    sync.Mutex
+	conns map[string]int // 每个地址的连接数
+
+	limited     uint64
+	mutes       uint64
+	disconnects uint64
+	rejected    uint64
+}
+
+func newRateLimiter(config *RateLimitConfig, maxMessageSize int64) *rateLimiter {
+	if config.ViolationWindow <= 0 {
+		config.ViolationWindow = defaultViolationWindow
+	}
+	if config.MuteDuration <= 0 {
+		config.MuteDuration = defaultMuteDuration
+	}
+	if config.BytesPerSecond > 0 && config.ByteBurst <= 0 {
+		config.ByteBurst = int(config.BytesPerSecond)
+		if int64(config.ByteBurst) < maxMessageSize {
+			config.ByteBurst = int(maxMessageSize)
+		}
+	}
+	return &rateLimiter{
+		config: config,
+		users:  newBucketGroup(config.UserMessagesPerSecond, config.UserBurst),
+		ips:    newBucketGroup(config.IpMessagesPerSecond, config.IpBurst),
+		conns:  make(map[string]int),
+	}
+}
+
+// acquire 登记地址的连接，超过最大连接数时返回 false
+func (l *rateLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if max := l.config.MaxConnectionsPerIp; max > 0 && l.conns[ip] >= max {
+		atomic.AddUint64(&l.rejected, 1)
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+// release 连接断开后释放地址的连接数
+func (l *rateLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[ip]--; l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+// connLimiter 连接级限流状态，仅在读协程内读写
+type connLimiter struct {
+	messages   *tokenBucket
+	bytes      *tokenBucket
+	violations []time.Time // 统计窗口内的违规时间
+	mutedUntil time.Time   // 临时禁言到期时间
+}
+
+func newConnLimiter(config *RateLimitConfig, now time.Time) *connLimiter {
+	l := &connLimiter{}
+	if config.MessagesPerSecond > 0 {
+		l.messages = newTokenBucket(config.MessagesPerSecond, config.MessageBurst, now)
+	}
+	if config.BytesPerSecond > 0 {
+		l.bytes = newTokenBucket(config.BytesPerSecond, config.ByteBurst, now)
+	}
+	return l
+}
+
+// limit 检查客户端消息是否超出限流，超出时返回错误，窗口内违规过多时临时禁言或断开连接
+func (c *connection) limit(size int) error {
+	l := c.server.limiter
+	if l == nil {
+		return nil
+	}
+	now := time.Now()
+	cl := c.limiter
+	if cl == nil {
+		cl = newConnLimiter(l.config, now)
+		c.limiter = cl
+	}
+	// 按与在线状态相同的用户身份限流，未登录的匿名连接只按地址限流
+	user := ""
+	if c.uid != 0 || c.user != "" {
+		user = c.presenceKey()
+	}
+	var err error
+	if now.Before(cl.mutedUntil) {
+		err = newProtocolError(CodeRateLimited, fmt.Sprintf("muted for flooding until %s", cl.mutedUntil.Format(time.RFC3339)))
+	} else if (cl.messages != nil && !cl.messages.allow(1, now)) ||
+		(cl.bytes != nil && !cl.bytes.allow(float64(size), now)) ||
+		!l.users.allow(user, now) || !l.ips.allow(c.ip, now) {
+		err = newProtocolError(CodeRateLimited, "rate limit exceeded")
+	}
+	if err == nil {
+		return nil
+	}
+	atomic.AddUint64(&l.limited, 1)
+
+	// 统计窗口内的违规次数
+	violations := cl.violations[:0]
+	for _, t := range cl.violations {
+		if now.Sub(t) < l.config.ViolationWindow {
+			violations = append(violations, t)
+		}
+	}
+	cl.violations = append(violations, now)
+	count := len(cl.violations)
+	if n := l.config.DisconnectAfter; n > 0 && count >= n {
+		atomic.AddUint64(&l.disconnects, 1)
+		c.close(websocket.ClosePolicyViolation, "rate limit exceeded")
+		return err
+	}
+	if n := l.config.MuteAfter; n > 0 && count >= n && !now.Before(cl.mutedUntil) {
+		atomic.AddUint64(&l.mutes, 1)
+		cl.mutedUntil = now.Add(l.config.MuteDuration)
+		env := NewEnvelope(TypeSystem, &SystemPayload{
+			Action:  ActionMute,
+			User:    c.user,
+			Until:   cl.mutedUntil.UnixMilli(),
+			Content: fmt.Sprintf("muted for %s for flooding", l.config.MuteDuration),
+		})
+		env.Room = c.room
+		c.trySend(env.encode())
+	}
+	return err
+}
+
+// RateLimitStats 限流计数，未启用限流时返回零值
+func (s *Server) RateLimitStats() RateLimitStats {
+	l := s.limiter
+	if l == nil {
+		return RateLimitStats{}
+	}
+	return RateLimitStats{
+		Limited:             atomic.LoadUint64(&l.limited),
+		Mutes:               atomic.LoadUint64(&l.mutes),
+		Disconnects:         atomic.LoadUint64(&l.disconnects),
+		RejectedConnections: atomic.LoadUint64(&l.rejected),
+	}
+}
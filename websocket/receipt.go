@@ -0,0 +1,169 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  receipt
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 8:30 下午
+ */
+
+package websocket
+
+import (
+	"time"
+)
+
+const (
+	defaultTypingInterval = 2 * time.Second
+	defaultRecallWindow   = 2 * time.Minute
+	sentCacheSize         = 256
+)
+
+// TypingPayload 正在输入消息内容
+type TypingPayload struct {
+	Typing bool `json:"typing"` // 是否正在输入
+}
+
+// ReceiptPayload 已读回执消息内容
+type ReceiptPayload struct {
+	Seq int64 `json:"seq"` // 已读的房间消息序号
+}
+
+// RecallPayload 撤回消息内容
+type RecallPayload struct {
+	Seq int64 `json:"seq"` // 撤回的房间消息序号
+}
+
+// HistoryRecaller 支持撤回的聊天记录存储，撤回的消息不再补发
+type HistoryRecaller interface {
+	Recall(room string, seq int64) error
+}
+
+// sentKey 连接发送过的房间消息
+type sentKey struct {
+	room string
+	seq  int64
+}
+
+// trackSent 记录连接发送的房间消息及发送时间，用于撤回时校验，仅在读协程内调用
+func (c *connection) trackSent(room string, seq int64, at time.Time) {
+	if c.sent == nil {
+		c.sent = make(map[sentKey]time.Time)
+	}
+	key := sentKey{room: room, seq: seq}
+	c.sent[key] = at
+	c.sentKeys = append(c.sentKeys, key)
+	if len(c.sentKeys) > sentCacheSize {
+		delete(c.sent, c.sentKeys[0])
+		c.sentKeys = c.sentKeys[1:]
+	}
+}
+
+// typing 转发正在输入状态，状态变化时立即转发，状态未变化时按间隔节流，不分配序号也不保存
+func (c *connection) typing(env *Envelope, payload *TypingPayload) error {
+	h := c.hub
+	if h == nil {
+		return newProtocolError(CodeNotLoggedIn, "not logged in")
+	}
+	now := time.Now()
+	if payload.Typing == c.typingState && now.Sub(c.typingAt) < c.server.config.TypingInterval {
+		return nil
+	}
+	c.typingState, c.typingAt = payload.Typing, now
+	msg := NewEnvelope(TypeTyping, payload)
+	msg.Room, msg.Uid, msg.From, msg.To = c.room, c.uid, c.user, env.To
+	data_b := msg.encode()
+	if env.To == "" {
+		h.publish(0, data_b)
+		return nil
+	}
+	c.sendRoomUser(env.To, data_b)
+	return nil
+}
+
+// receipt 向消息发送方回报已读回执，env.To 为消息发送方
+func (c *connection) receipt(env *Envelope, payload *ReceiptPayload) error {
+	if c.hub == nil {
+		return newProtocolError(CodeNotLoggedIn, "not logged in")
+	}
+	if env.To == "" || payload.Seq <= 0 {
+		return newProtocolError(CodeInvalidPayload, "sender and seq required")
+	}
+	msg := NewEnvelope(TypeRead, payload)
+	msg.Room, msg.Uid, msg.From, msg.To = c.room, c.uid, c.user, env.To
+	c.sendRoomUser(env.To, msg.encode())
+	return nil
+}
+
+// sendRoomUser 向当前房间内的用户发送消息，用户不在该房间内时不发送
+func (c *connection) sendRoomUser(to string, data []byte) {
+	h := c.hub
+	h.call(func() { h.sendUser(to, data) })
+	if bp := c.server.rooms.backplane; bp != nil {
+		bp.sendRoomUser(h.name, to, data)
+	}
+}
+
+// recall 撤回自己在撤回时限内发送的房间消息，并通知房间所有成员
+func (c *connection) recall(payload *RecallPayload) error {
+	h := c.hub
+	if h == nil {
+		return newProtocolError(CodeNotLoggedIn, "not logged in")
+	}
+	window := c.server.config.RecallWindow
+	if window < 0 {
+		return newProtocolError(CodeRecallDenied, "recall disabled")
+	}
+	sentAt, ok := c.sentAt(payload.Seq)
+	if !ok {
+		return newProtocolError(CodeRecallDenied, "message not found")
+	}
+	if time.Since(sentAt) > window {
+		return newProtocolError(CodeRecallDenied, "recall window expired")
+	}
+	if recaller, ok := c.server.config.History.(HistoryRecaller); ok {
+		if err := recaller.Recall(c.room, payload.Seq); err != nil {
+			c.logError(err)
+			return newProtocolError(CodeInternalError, "recall failed")
+		}
+	}
+	delete(c.sent, sentKey{room: c.room, seq: payload.Seq})
+	h.call(func() { h.forget(payload.Seq) })
+	msg := NewEnvelope(TypeRecall, payload)
+	msg.Room, msg.Uid, msg.From = c.room, c.uid, c.user
+	h.publish(0, msg.encode())
+	return nil
+}
+
+// sentAt 查找当前房间中由该用户发送的消息的发送时间，本连接未记录时从聊天记录中查找
+func (c *connection) sentAt(seq int64) (time.Time, bool) {
+	if at, ok := c.sent[sentKey{room: c.room, seq: seq}]; ok {
+		return at, true
+	}
+	store := c.server.config.History
+	if store == nil || seq <= 0 {
+		return time.Time{}, false
+	}
+	messages, err := store.Since(c.room, seq-1, 1)
+	if err != nil {
+		c.logError(err)
+		return time.Time{}, false
+	}
+	if len(messages) == 0 {
+		return time.Time{}, false
+	}
+	msg := messages[0]
+	if msg.Seq != seq || msg.Type != TypeUser || msg.From != c.user || msg.Uid != c.uid {
+		return time.Time{}, false
+	}
+	return msg.CreatedAt, true
+}
+
+// forget 从最近消息缓存中移除撤回的消息，仅在房间协程内调用
+func (h *hub) forget(seq int64) {
+	for i, msg := range h.recent {
+		if msg.seq == seq {
+			h.recent = append(h.recent[:i], h.recent[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  retention
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 11:20 下午
+ */
+
+package websocket
+
+import (
+	"go-library/logger"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultRetentionInterval = time.Hour
+
+// PurgeQuery 聊天记录清理条件
+type PurgeQuery struct {
+	Room    string    // 清理的房间，为空时清理 Exclude 以外的所有房间与私聊消息
+	Exclude []string  // Room 为空时跳过的房间
+	Before  time.Time // 删除该时间之前的消息
+}
+
+// HistoryPurger 支持按保留期清理的聊天记录存储
+type HistoryPurger interface {
+	// Purge 删除符合条件的消息，返回删除的条数
+	Purge(query *PurgeQuery) (int64, error)
+}
+
+// RetentionConfig 聊天记录保留策略
+type RetentionConfig struct {
+	Store    HistoryPurger  // 聊天记录存储，如 GormHistoryStore
+	Days     int            // 默认保留天数，为 0 时不清理未单独设置的房间
+	Rooms    map[string]int // 按房间设置的保留天数，覆盖 Days，小于等于 0 时永久保留
+	Interval time.Duration  // 清理间隔，默认 1 小时
+	Logger   *logger.Logger // 日志对象，为空时不输出日志
+}
+
+// Retention 按保留策略定期清理聊天记录
+type Retention struct {
+	config *RetentionConfig
+	logger *logger.Logger
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewRetention 创建聊天记录清理任务，调用 Start 后开始定期清理
+func NewRetention(config *RetentionConfig) *Retention {
+	if config.Interval <= 0 {
+		config.Interval = defaultRetentionInterval
+	}
+	l := config.Logger
+	if l == nil {
+		l = &logger.Logger{Logger: zap.NewNop()}
+	}
+	return &Retention{config: config, logger: l}
+}
+
+// Purge 按保留策略清理一次，now 为计算保留期的当前时间，返回删除的条数
+func (r *Retention) Purge(now time.Time) (int64, error) {
+	rooms := make([]string, 0, len(r.config.Rooms))
+	for room := range r.config.Rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	var total int64
+	for _, room := range rooms {
+		days := r.config.Rooms[room]
+		if days <= 0 {
+			continue
+		}
+		deleted, err := r.config.Store.Purge(&PurgeQuery{Room: room, Before: now.AddDate(0, 0, -days)})
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+		r.logPurged(room, days, deleted)
+	}
+	if r.config.Days > 0 {
+		deleted, err := r.config.Store.Purge(&PurgeQuery{Exclude: rooms, Before: now.AddDate(0, 0, -r.config.Days)})
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+		r.logPurged("", r.config.Days, deleted)
+	}
+	return total, nil
+}
+
+func (r *Retention) logPurged(room string, days int, deleted int64) {
+	if deleted > 0 {
+		r.logger.Logger.Info("history purged", zap.String("room", room), zap.Int("days", days), zap.Int64("deleted", deleted))
+	}
+}
+
+// Start 启动定时清理，启动时立即清理一次，重复调用无效
+func (r *Retention) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop != nil {
+		return
+	}
+	r.stop, r.done = make(chan struct{}), make(chan struct{})
+	go r.run(r.stop, r.done)
+}
+
+// Stop 停止定时清理并等待正在进行的清理结束
+func (r *Retention) Stop() {
+	r.mu.Lock()
+	stop, done := r.stop, r.done
+	r.stop, r.done = nil, nil
+	r.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (r *Retention) run(stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Purge(time.Now()); err != nil {
+			r.logger.Logger.Error(err.Error())
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,187 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  room
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 2:15 下午
+ */
+
+package websocket
+
+import (
+	"context"
+	"errors"
+	"go-library/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultRoomIdleTimeout 空房间默认保留时间
+const defaultRoomIdleTimeout = 30 * time.Second
+
+var ErrRoomNotFound = errors.New("room not found")
+
+// RoomInfo 房间信息
+type RoomInfo struct {
+	Name      string            `json:"name"`       // 房间名
+	Members   []*RoomUser       `json:"members"`    // 用户列表
+	Count     int               `json:"count"`      // 连接数
+	Metadata  map[string]string `json:"metadata"`   // 元数据
+	CreatedAt time.Time         `json:"created_at"` // 创建时间
+}
+
+// roomManager 房间管理器，负责房间的创建与销毁
+type roomManager struct {
+	idleTimeout time.Duration
+	backplane   *Backplane
+	history     HistoryStore
+	moderation  ModerationStore
+	logger      *logger.Logger
+	metrics     *metrics
+	bots        []*Bot
+	bufferSize  int // 每个房间缓存的最近消息数量
+
+	mu     sync.Mutex
+	rooms  map[string]*hub
+	closed bool
+}
+
+func newRoomManager(idleTimeout time.Duration) *roomManager {
+	if idleTimeout <= 0 {
+		idleTimeout = defaultRoomIdleTimeout
+	}
+	return &roomManager{
+		idleTimeout: idleTimeout,
+		rooms:       make(map[string]*hub),
+	}
+}
+
+// getOrCreate 获取房间，不存在时创建并启动房间协程，管理器已关闭时返回 nil
+func (m *roomManager) getOrCreate(name string) *hub {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	h := m.rooms[name]
+	if h == nil {
+		h = newHub(name, m)
+		m.rooms[name] = h
+		go h.run()
+	}
+	return h
+}
+
+// get 获取已存在的房间
+func (m *roomManager) get(name string) *hub {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rooms[name]
+}
+
+// join 在房间协程内执行 f，房间恰好被销毁时重新创建房间后重试
+func (m *roomManager) join(name string, f func(h *hub)) *hub {
+	for {
+		h := m.getOrCreate(name)
+		if h == nil {
+			return nil
+		}
+		if h.call(func() { f(h) }) {
+			return h
+		}
+	}
+}
+
+// remove 由房间协程在空闲超时后调用，从管理器中移除房间
+func (m *roomManager) remove(h *hub) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rooms[h.name] != h {
+		return false
+	}
+	delete(m.rooms, h.name)
+	return true
+}
+
+// list 当前所有房间
+func (m *roomManager) list() []*hub {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hubs := make([]*hub, 0, len(m.rooms))
+	for _, h := range m.rooms {
+		hubs = append(hubs, h)
+	}
+	return hubs
+}
+
+// close 停止所有房间协程
+func (m *roomManager) close() {
+	m.mu.Lock()
+	m.closed = true
+	hubs := make([]*hub, 0, len(m.rooms))
+	for _, h := range m.rooms {
+		hubs = append(hubs, h)
+	}
+	m.rooms = make(map[string]*hub)
+	m.mu.Unlock()
+	for _, h := range hubs {
+		h.stop()
+	}
+}
+
+// Rooms 获取所有房间信息，按房间名排序
+func (s *Server) Rooms() []RoomInfo {
+	hubs := s.rooms.list()
+	infos := make([]RoomInfo, 0, len(hubs))
+	for _, h := range hubs {
+		var info RoomInfo
+		if h.call(func() { info = h.info() }) {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Room 获取指定房间信息
+func (s *Server) Room(name string) (info RoomInfo, err error) {
+	h := s.rooms.get(name)
+	if h == nil || !h.call(func() { info = h.info() }) {
+		return info, ErrRoomNotFound
+	}
+	return info, nil
+}
+
+// RoomMembers 获取房间用户列表，启用多节点总线时返回所有节点的用户
+func (s *Server) RoomMembers(name string) ([]*RoomUser, error) {
+	if bp := s.rooms.backplane; bp != nil {
+		return bp.members(context.Background(), name)
+	}
+	info, err := s.Room(name)
+	if err != nil {
+		return nil, err
+	}
+	return info.Members, nil
+}
+
+// RoomCount 当前房间数量
+func (s *Server) RoomCount() int {
+	return len(s.rooms.list())
+}
+
+// ConnectionCount 当前连接数量
+func (s *Server) ConnectionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// SetRoomMetadata 设置房间元数据
+func (s *Server) SetRoomMetadata(name string, key string, value string) error {
+	h := s.rooms.get(name)
+	if h == nil || !h.call(func() { h.metadata[key] = value }) {
+		return ErrRoomNotFound
+	}
+	return nil
+}
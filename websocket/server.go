@@ -9,17 +9,317 @@
 package websocket
 
 import (
-	"fmt"
-	"github.com/gorilla/mux"
+	"context"
+	"errors"
+	"go-library/logger"
+	"net"
 	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
 )
 
-func StartServer() {
+const (
+	defaultAddr            = "127.0.0.1:8080"
+	defaultPath            = "/ws"
+	defaultReadBufferSize  = 512
+	defaultWriteBufferSize = 512
+	defaultPongWait        = 60 * time.Second
+	defaultWriteTimeout    = 10 * time.Second
+	defaultMaxMessageSize  = 64 * 1024
+)
+
+// ServerConfig 服务配置
+type ServerConfig struct {
+	Addr              string                     // 监听地址，默认 127.0.0.1:8080
+	Path              string                     // websocket 路由，默认 /ws
+	CertFile          string                     // TLS 证书文件，与 KeyFile 同时设置时启用 TLS
+	KeyFile           string                     // TLS 私钥文件
+	ReadBufferSize    int                        // 读缓冲区大小，默认 512
+	WriteBufferSize   int                        // 写缓冲区大小，默认 512
+	CheckOrigin       func(r *http.Request) bool // 自定义来源检查，设置后忽略 AllowedOrigins
+	AllowedOrigins    []string                   // 允许的来源，支持 scheme://host、host（不含端口时匹配任意端口）、*.example.com、* 与 null（本地打开的页面），为空时只允许同源
+	TrustedProxies    []string                   // 可信代理的 ip 或 CIDR，来自可信代理的请求从 X-Forwarded-For、X-Real-IP 获取客户端地址
+	Logger            *logger.Logger             // 日志对象，为空时不输出日志
+	RoomIdleTimeout   time.Duration              // 空房间保留时间，超时后销毁房间，默认 30 秒
+	Backplane         *Backplane                 // 多节点消息总线，为空时仅在本节点内广播
+	Auth              *AuthConfig                // 握手鉴权配置，为空时不校验 token
+	History           HistoryStore               // 聊天记录存储，为空时不保存聊天记录
+	HistoryReplay     int                        // 登录时补发的聊天记录条数，默认 20，小于 0 时不补发
+	PingInterval      time.Duration              // 心跳间隔，默认为 PongWait 的 9/10，必须小于 PongWait
+	PongWait          time.Duration              // 等待客户端响应的最长时间，超时视为断线，默认 60 秒
+	WriteTimeout      time.Duration              // 单条消息写超时，默认 10 秒
+	MaxMessageSize    int64                      // 客户端消息最大字节数，默认 64KB
+	Moderation        ModerationStore            // 房间管理数据存储，为空时房间设置、角色与处罚仅保存在内存中
+	Hooks             []Hook                     // 连接生命周期钩子，按顺序执行
+	Filters           []MessageFilter            // 消息过滤链，房间消息与私聊消息广播前依次执行
+	RateLimit         *RateLimitConfig           // 限流配置，为空时不限流
+	ResumeWindow      time.Duration              // 断线后保留会话的时间，窗口内重连可恢复身份与房间，为 0 时不启用
+	ResumeBufferSize  int                        // 每个房间为会话恢复缓存的最近消息数，默认 256
+	API               *APIConfig                 // 后端推送接口配置，为空时不挂载接口
+	Inbox             InboxStore                 // 离线收件箱存储，为空时不支持按 uid 发送消息
+	TypingInterval    time.Duration              // 正在输入状态未变化时的最短转发间隔，默认 2 秒
+	RecallWindow      time.Duration              // 消息发送后可撤回的时限，默认 2 分钟，小于 0 时不允许撤回
+	SendQueueSize     int                        // 每个连接的发送队列长度，默认 256
+	SlowConsumer      SlowConsumerPolicy         // 发送队列已满时的处理方式，默认断开连接
+	EnableCompression bool                       // 是否协商 permessage-deflate 压缩，客户端同样需要启用
+	HTTPTransports    bool                       // 是否启用 SSE 与长轮询降级传输，路由为 Path 加 /sse、/poll、/send
+	PollTimeout       time.Duration              // 长轮询请求最长等待时间，默认 25 秒
+	HTTPIdleTimeout   time.Duration              // 长轮询连接超过该时间未轮询时关闭，默认 60 秒
+	CompressionLevel  int                        // 压缩级别，取值 -2 到 9，默认 1（最快）
+	Codecs            []Codec                    // 可通过 Sec-WebSocket-Protocol 协商的编码，未协商的连接使用 JSON
+	MetricsPath       string                     // Prometheus 文本格式指标路由，为空时不挂载，需自行限制访问来源
+	Bots              []*Bot                     // 进程内机器人，按各自的 Rooms 加入房间并响应命令
+}
+
+// Server websocket 聊天服务
+type Server struct {
+	config     *ServerConfig
+	upgrader   *websocket.Upgrader
+	logger     *logger.Logger
+	httpServer *http.Server
+
+	rooms    *roomManager
+	users    *userIndex
+	uids     *userIndex       // 鉴权连接按 uid 的索引
+	sessions *sessionRegistry // 会话索引，未启用会话恢复时为空
+	http     *httpConns       // HTTP 传输的连接索引
+	limiter  *rateLimiter     // 限流状态，未启用限流时为空
+	codecs   map[string]Codec // 按子协议名索引的编码
+	metrics  *metrics
+	origins  *originPolicy // 来源白名单，为空时只允许同源
+	proxies  []*net.IPNet  // 可信代理网段
+
+	slowConsumers int64 // 发送队列溢出次数
+
+	mu      sync.Mutex
+	conns   map[*connection]struct{}
+	closing bool
+	wg      sync.WaitGroup
+}
+
+// NewServer 创建 websocket 服务，config 为空时使用默认配置
+func NewServer(config *ServerConfig) *Server {
+	if config == nil {
+		config = &ServerConfig{}
+	}
+	if config.Addr == "" {
+		config.Addr = defaultAddr
+	}
+	if config.Path == "" {
+		config.Path = defaultPath
+	}
+	if config.ReadBufferSize <= 0 {
+		config.ReadBufferSize = defaultReadBufferSize
+	}
+	if config.WriteBufferSize <= 0 {
+		config.WriteBufferSize = defaultWriteBufferSize
+	}
+	if config.PongWait <= 0 {
+		config.PongWait = defaultPongWait
+	}
+	if config.PingInterval <= 0 || config.PingInterval >= config.PongWait {
+		config.PingInterval = config.PongWait * 9 / 10
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = defaultWriteTimeout
+	}
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = defaultMaxMessageSize
+	}
+	if config.HistoryReplay == 0 {
+		config.HistoryReplay = defaultHistoryReplay
+	}
+	if config.TypingInterval <= 0 {
+		config.TypingInterval = defaultTypingInterval
+	}
+	if config.RecallWindow == 0 {
+		config.RecallWindow = defaultRecallWindow
+	}
+	if config.PollTimeout <= 0 {
+		config.PollTimeout = defaultPollTimeout
+	}
+	if config.HTTPIdleTimeout <= 0 {
+		config.HTTPIdleTimeout = defaultHTTPIdleTimeout
+	}
+	if config.SendQueueSize <= 0 {
+		config.SendQueueSize = defaultSendQueueSize
+	}
+	if config.CompressionLevel == 0 {
+		config.CompressionLevel = defaultCompressionLevel
+	}
+	if config.ResumeBufferSize <= 0 {
+		config.ResumeBufferSize = defaultResumeBufferSize
+	}
+	l := config.Logger
+	if l == nil {
+		l = &logger.Logger{Logger: zap.NewNop()}
+	}
+	s := &Server{
+		config: config,
+		upgrader: &websocket.Upgrader{
+			ReadBufferSize:    config.ReadBufferSize,
+			WriteBufferSize:   config.WriteBufferSize,
+			CheckOrigin:       func(r *http.Request) bool { return true }, // 已在 open 中检查来源
+			EnableCompression: config.EnableCompression,
+		},
+		logger:  l,
+		rooms:   newRoomManager(config.RoomIdleTimeout),
+		users:   newUserIndex(),
+		uids:    newUserIndex(),
+		http:    &httpConns{conns: make(map[string]*connection)},
+		conns:   make(map[*connection]struct{}),
+		codecs:  map[string]Codec{ProtocolJSON: defaultCodec},
+		metrics: newMetrics(),
+		origins: newOriginPolicy(config.AllowedOrigins),
+	}
+	proxies, invalid := parseTrustedProxies(config.TrustedProxies)
+	for _, proxy := range invalid {
+		l.Logger.Warn("invalid trusted proxy ignored", zap.String("proxy", proxy))
+	}
+	s.proxies = proxies
+	for _, codec := range config.Codecs {
+		s.codecs[codec.Name()] = codec
+	}
+	s.rooms.history = config.History
+	s.rooms.moderation = config.Moderation
+	s.rooms.logger = l
+	s.rooms.metrics = s.metrics
+	s.rooms.bots = config.Bots
+	if config.RateLimit != nil {
+		s.limiter = newRateLimiter(config.RateLimit, config.MaxMessageSize)
+	}
+	if config.ResumeWindow > 0 {
+		s.sessions = newSessionRegistry(config.ResumeWindow)
+		s.rooms.bufferSize = config.ResumeBufferSize
+	}
+	if config.Backplane != nil {
+		s.rooms.backplane = config.Backplane
+		s.users.backplane = config.Backplane
+		config.Backplane.start(s.rooms, s.users, s.uids, s.sendAll, l)
+	}
+	return s
+}
 
+// Handler 返回挂载了 websocket 路由的 http.Handler，便于嵌入已有服务
+func (s *Server) Handler() http.Handler {
 	router := mux.NewRouter()
-	go runChan()
-	router.HandleFunc("/ws", myws)
-	if err := http.ListenAndServe("127.0.0.1:8080", router); err != nil {
-		fmt.Println("err:", err)
+	router.Handle(s.config.Path, s)
+	if s.config.HTTPTransports {
+		s.mountTransports(router)
+	}
+	if s.config.API != nil {
+		s.mountAPI(router)
+	}
+	if s.config.MetricsPath != "" {
+		router.HandleFunc(s.config.MetricsPath, s.serveMetrics).Methods(http.MethodGet)
+	}
+	return router
+}
+
+// Start 启动服务并阻塞，调用 Shutdown 后返回 nil
+func (s *Server) Start() error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	s.httpServer = &http.Server{Addr: s.config.Addr, Handler: s.Handler()}
+	httpServer := s.httpServer
+	s.mu.Unlock()
+
+	var err error
+	if s.config.CertFile != "" && s.config.KeyFile != "" {
+		err = httpServer.ListenAndServeTLS(s.config.CertFile, s.config.KeyFile)
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown 优雅关闭服务：停止接收新连接，向所有客户端发送关闭帧，停止所有房间协程
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closing = true
+	httpServer := s.httpServer
+	conns := make([]*connection, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	// 先关闭连接，使 SSE 等长时间运行的请求结束，http 服务才能完成关闭
+	for _, c := range conns {
+		c.close(websocket.CloseGoingAway, "server shutdown")
+	}
+	var err error
+	if httpServer != nil {
+		err = httpServer.Shutdown(ctx)
+	}
+	if s.sessions != nil {
+		s.sessions.close()
+	}
+	s.rooms.close()
+	if bp := s.rooms.backplane; bp != nil {
+		bp.stop()
+	}
+
+	// 等待所有连接的读写协程退出
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+	return err
+}
+
+// addConn 登记连接，服务关闭中时返回 false
+func (s *Server) addConn(c *connection) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+// isClosing 服务是否正在关闭
+func (s *Server) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+func (s *Server) removeConn(c *connection) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// StartServer 使用默认配置启动服务，允许本地打开的 index.html 连接
+func StartServer() {
+	s := NewServer(&ServerConfig{AllowedOrigins: []string{"null"}})
+	if err := s.Start(); err != nil {
+		s.logger.Logger.Error(err.Error())
 	}
 }
@@ -0,0 +1,191 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  session
+ * @Version: 1.0.0
+ * @Date: 2026/10/18 10:20 下午
+ */
+
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const defaultResumeBufferSize = 256
+
+// session 可恢复的会话，连接断开后在恢复窗口内保留身份与房间
+type session struct {
+	id    string
+	conn  *connection // 会话当前所属的连接
+	timer *time.Timer // 断线后等待恢复的计时，连接在线时为空
+}
+
+// sessionRegistry 会话索引
+type sessionRegistry struct {
+	window time.Duration // 断线后保留会话的时间
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newSessionRegistry(window time.Duration) *sessionRegistry {
+	return &sessionRegistry{window: window, sessions: make(map[string]*session)}
+}
+
+// create 为连接创建会话
+func (r *sessionRegistry) create(c *connection) *session {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	s := &session{id: hex.EncodeToString(b), conn: c}
+	r.mu.Lock()
+	r.sessions[s.id] = s
+	r.mu.Unlock()
+	return s
+}
+
+// remove 删除会话
+func (r *sessionRegistry) remove(s *session) {
+	r.mu.Lock()
+	if r.sessions[s.id] == s {
+		delete(r.sessions, s.id)
+	}
+	r.mu.Unlock()
+}
+
+// detach 连接断开后保留会话，恢复窗口内未恢复时执行 expire
+func (r *sessionRegistry) detach(s *session, expire func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s.timer = time.AfterFunc(r.window, func() {
+		r.mu.Lock()
+		// 会话已被恢复
+		if r.sessions[s.id] != s || s.timer == nil {
+			r.mu.Unlock()
+			return
+		}
+		delete(r.sessions, s.id)
+		r.mu.Unlock()
+		expire()
+	})
+}
+
+// resume 将断开的会话转移到新连接，返回原连接
+func (r *sessionRegistry) resume(id string, c *connection) (*connection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.sessions[id]
+	if s == nil || s.timer == nil {
+		return nil, newProtocolError(CodeSessionExpired, "session expired")
+	}
+	old := s.conn
+	// 鉴权会话只能由同一 uid 恢复，匿名会话只能由匿名连接恢复
+	if (old.claims != nil && (c.claims == nil || c.uid != old.uid)) || (old.claims == nil && c.claims != nil) {
+		return nil, newProtocolError(CodeInvalidToken, ErrUidMismatch.Error())
+	}
+	if !s.timer.Stop() {
+		return nil, newProtocolError(CodeSessionExpired, "session expired")
+	}
+	if c.session != nil {
+		delete(r.sessions, c.session.id)
+	}
+	s.conn, s.timer = c, nil
+	c.session = s
+	return old, nil
+}
+
+// close 停止所有等待恢复的计时
+func (r *sessionRegistry) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, s := range r.sessions {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		delete(r.sessions, id)
+	}
+}
+
+// detach 连接断开时保留会话等待恢复，未启用会话恢复或未加入房间时返回 false
+func (c *connection) detach() bool {
+	registry := c.server.sessions
+	if registry == nil || c.session == nil {
+		return false
+	}
+	h := c.hub
+	if h == nil || c.server.isClosing() {
+		registry.remove(c.session)
+		return false
+	}
+	member := false
+	h.call(func() {
+		if _, member = h.c[c]; member {
+			h.c[c] = false
+		}
+	})
+	if !member {
+		registry.remove(c.session)
+		return false
+	}
+	c.server.users.remove(c.user, c)
+	registry.detach(c.session, c.leave)
+	return true
+}
+
+// resume 恢复断开的会话：接管原连接的身份与房间，不广播上下线消息，并补发断线期间的房间消息
+func (c *connection) resume(payload *ResumePayload) error {
+	registry := c.server.sessions
+	if registry == nil {
+		return newProtocolError(CodeSessionExpired, "session resume disabled")
+	}
+	c.leave()
+	old, err := registry.resume(payload.Session, c)
+	if err != nil {
+		return err
+	}
+	c.room, c.user, c.name, c.hub = old.room, old.user, old.name, old.hub
+	if c.claims == nil {
+		c.uid = old.uid
+	}
+	c.acks, c.ackIds = old.acks, old.ackIds
+	c.sent, c.sentKeys = old.sent, old.sentKeys
+
+	h := c.hub
+	member, replay := false, false
+	h.call(func() {
+		// 断线期间已被移出房间
+		if _, member = h.c[old]; !member {
+			return
+		}
+		delete(h.c, old)
+		h.c[c] = true
+		// 在房间协程内写入，保证成员快照与补发消息先于之后的广播
+		env := NewEnvelope(TypeResume, &MemberPayload{User: c.user, Name: c.name, Uid: c.uid, Ip: c.ip, UserList: h.users()})
+		env.Room, env.Uid, env.From = h.name, c.uid, c.user
+		c.trySend(env.encode())
+		missed, complete := h.since(payload.Seq)
+		// 缓存中缺少部分消息时从聊天记录补发
+		if replay = !complete && c.server.replayEnabled(); replay {
+			h.hold(c)
+			return
+		}
+		for _, data := range missed {
+			c.trySend(data)
+		}
+	})
+	if !member {
+		c.hub = nil
+		registry.remove(c.session)
+		c.session = nil
+		return newProtocolError(CodeSessionExpired, "session expired")
+	}
+	if replay {
+		c.replay(h, payload.Seq)
+	}
+	c.server.users.add(c.user, c)
+	c.deliverInbox()
+	return nil
+}
@@ -0,0 +1,85 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  trackbot
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 9:40 下午
+ */
+
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"go-library/logistics"
+	"strings"
+)
+
+const (
+	defaultTrackingBotName = "logistics"
+	defaultTrackingLines   = 5
+	trackCommand           = "track"
+)
+
+var ErrQuerierRequired = errors.New("tracking bot requires a querier")
+
+// ExpressQuerier 物流信息查询，*logistics.Logistics 实现了该接口
+type ExpressQuerier interface {
+	GetExpInfo(nu string, com string, phone string) (expInfoList []logistics.ExpInfo, reqBody string, err error)
+}
+
+// TrackingBotConfig 物流查询机器人配置
+type TrackingBotConfig struct {
+	BotConfig                // 机器人配置，Name 默认 logistics
+	Querier   ExpressQuerier // 物流信息查询，必填，通常为 logistics.NewLogistics 创建的对象
+	MaxLines  int            // 回复的物流记录条数，默认 5
+}
+
+// NewTrackingBot 创建物流查询机器人，响应 /track 单号 [快递公司编码] [手机号后四位]，未设置 Querier 时返回错误
+func NewTrackingBot(config *TrackingBotConfig) (*Bot, error) {
+	if config.Querier == nil {
+		return nil, ErrQuerierRequired
+	}
+	if config.Name == "" {
+		config.Name = defaultTrackingBotName
+	}
+	if config.MaxLines <= 0 {
+		config.MaxLines = defaultTrackingLines
+	}
+	b := NewBot(&config.BotConfig)
+	b.Handle(trackCommand, "单号 [快递公司编码] [手机号后四位]  查询物流信息", func(req *BotRequest) error {
+		return track(config, req)
+	})
+	return b, nil
+}
+
+// track 查询物流信息并回复最近的物流记录
+func track(config *TrackingBotConfig, req *BotRequest) error {
+	if len(req.Args) == 0 {
+		return req.Reply(fmt.Sprintf("用法: %s%s 单号 [快递公司编码] [手机号后四位]", config.Prefix, trackCommand))
+	}
+	nu := req.Args[0]
+	var com, phone string
+	if len(req.Args) > 1 {
+		com = req.Args[1]
+	}
+	if len(req.Args) > 2 {
+		phone = req.Args[2]
+	}
+	expInfoList, _, err := config.Querier.GetExpInfo(nu, com, phone)
+	if err != nil {
+		return err
+	}
+	if len(expInfoList) == 0 {
+		return req.Reply(fmt.Sprintf("单号 %s 暂无物流信息", nu))
+	}
+	if len(expInfoList) > config.MaxLines {
+		expInfoList = expInfoList[:config.MaxLines]
+	}
+	lines := make([]string, 0, len(expInfoList)+1)
+	lines = append(lines, fmt.Sprintf("单号 %s 物流信息:", nu))
+	for _, info := range expInfoList {
+		lines = append(lines, info.Time+" "+info.Context)
+	}
+	return req.Reply(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,234 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  transcript
+ * @Version: 1.0.0
+ * @Date: 2026/10/20 10:40 下午
+ */
+
+package websocket
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// 导出格式
+const (
+	ExportJSON = "json" // JSON 数组，字段与 Message 一致
+	ExportCSV  = "csv"  // 带表头的 CSV
+	ExportText = "text" // 每行一条消息的纯文本
+)
+
+const (
+	exportBatchSize = 500
+	exportTimeFmt   = "2006-01-02 15:04:05"
+)
+
+var (
+	ErrExportUnsupported = errors.New("history store does not support export")
+	ErrExportFormat      = errors.New("unknown export format")
+)
+
+// HistoryExporter 支持导出的聊天记录存储
+type HistoryExporter interface {
+	// Export 按记录标识升序遍历房间在 [start, end) 内的所有消息，包括已撤回的消息，零值时间不参与过滤，f 返回错误时停止遍历
+	Export(room string, start time.Time, end time.Time, f func(msg *Message) error) error
+}
+
+// TranscriptQuery 聊天记录导出条件
+type TranscriptQuery struct {
+	Room   string    // 房间名
+	Start  time.Time // 开始时间（包含），零值时不限制
+	End    time.Time // 结束时间（不包含），零值时不限制
+	Format string    // 导出格式，默认 json
+}
+
+// transcriptWriter 按格式写入导出内容
+type transcriptWriter interface {
+	write(msg *Message) error
+	close() error
+}
+
+// ExportTranscript 将房间在时间范围内的聊天记录按格式写入 w，逐批读取，不在内存中保留整个房间的消息
+func ExportTranscript(store HistoryExporter, w io.Writer, query *TranscriptQuery) error {
+	tw, err := newTranscriptWriter(w, query.Format)
+	if err != nil {
+		return err
+	}
+	if err := store.Export(query.Room, query.Start, query.End, tw.write); err != nil {
+		return err
+	}
+	return tw.close()
+}
+
+func newTranscriptWriter(w io.Writer, format string) (transcriptWriter, error) {
+	switch format {
+	case ExportJSON, "":
+		return &jsonTranscript{w: bufio.NewWriter(w)}, nil
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "room", "seq", "type", "uid", "from", "to", "content", "ip", "recalled", "created_at"}); err != nil {
+			return nil, err
+		}
+		return &csvTranscript{w: cw}, nil
+	case ExportText:
+		return &textTranscript{w: bufio.NewWriter(w)}, nil
+	}
+	return nil, ErrExportFormat
+}
+
+// jsonTranscript 逐条编码的 JSON 数组
+type jsonTranscript struct {
+	w     *bufio.Writer
+	count int
+}
+
+func (t *jsonTranscript) write(msg *Message) error {
+	sep := ","
+	if t.count == 0 {
+		sep = "["
+	}
+	t.count++
+	if _, err := t.w.WriteString(sep); err != nil {
+		return err
+	}
+	data_b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = t.w.Write(data_b)
+	return err
+}
+
+func (t *jsonTranscript) close() error {
+	end := "]\n"
+	if t.count == 0 {
+		end = "[]\n"
+	}
+	if _, err := t.w.WriteString(end); err != nil {
+		return err
+	}
+	return t.w.Flush()
+}
+
+type csvTranscript struct {
+	w *csv.Writer
+}
+
+func (t *csvTranscript) write(msg *Message) error {
+	return t.w.Write([]string{
+		strconv.FormatInt(msg.Id, 10),
+		csvSafe(msg.Room),
+		strconv.FormatInt(msg.Seq, 10),
+		csvSafe(msg.Type),
+		strconv.FormatInt(msg.Uid, 10),
+		csvSafe(msg.From),
+		csvSafe(msg.To),
+		csvSafe(msg.Content),
+		csvSafe(msg.Ip),
+		strconv.FormatBool(msg.Recalled),
+		msg.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+// csvSafe 以 ' 前缀转义可能被电子表格当作公式执行的字段
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (t *csvTranscript) close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// textTranscript 形如 [2006-01-02 15:04:05] from -> to: content 的纯文本，多行内容的后续行缩进
+type textTranscript struct {
+	w *bufio.Writer
+}
+
+// textLineReplacer 统一换行符并缩进后续行，避免消息内容伪造出新的记录行
+var textLineReplacer = strings.NewReplacer("\r\n", "\n    ", "\r", "\n    ", "\n", "\n    ")
+
+func (t *textTranscript) write(msg *Message) error {
+	from := textLineReplacer.Replace(msg.From)
+	if msg.To != "" {
+		from += " -> " + textLineReplacer.Replace(msg.To)
+	}
+	recalled := ""
+	if msg.Recalled {
+		recalled = " [已撤回]"
+	}
+	_, err := fmt.Fprintf(t.w, "[%s] %s: %s%s\n", msg.CreatedAt.Format(exportTimeFmt), from, textLineReplacer.Replace(msg.Content), recalled)
+	return err
+}
+
+func (t *textTranscript) close() error {
+	return t.w.Flush()
+}
+
+// ExportTranscript 导出房间聊天记录，聊天记录存储需实现 HistoryExporter
+func (s *Server) ExportTranscript(w io.Writer, query *TranscriptQuery) error {
+	store, ok := s.config.History.(HistoryExporter)
+	if !ok {
+		return ErrExportUnsupported
+	}
+	return ExportTranscript(store, w, query)
+}
+
+// apiTranscript 导出房间聊天记录，start 与 end 为 RFC3339 时间，format 为 json、csv 或 text
+func (s *Server) apiTranscript(w http.ResponseWriter, r *http.Request) {
+	query := &TranscriptQuery{Room: mux.Vars(r)["room"], Format: r.URL.Query().Get("format")}
+	for name, t := range map[string]*time.Time{"start": &query.Start, "end": &query.End} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, &ProtocolError{Code: CodeInvalidPayload, Message: name + " must be RFC3339"})
+			return
+		}
+		*t = parsed
+	}
+	if _, ok := s.config.History.(HistoryExporter); !ok {
+		writeAPIError(w, http.StatusNotImplemented, &ProtocolError{Code: CodeUnknownType, Message: ErrExportUnsupported.Error()})
+		return
+	}
+	contentType := map[string]string{ExportJSON: "application/json", "": "application/json", ExportCSV: "text/csv", ExportText: "text/plain"}[query.Format]
+	if contentType == "" {
+		writeAPIError(w, http.StatusBadRequest, &ProtocolError{Code: CodeInvalidPayload, Message: ErrExportFormat.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(query.Room+"."+exportExtension(query.Format)))
+	// 响应头已写出，导出中途失败时只能记录日志
+	if err := s.ExportTranscript(w, query); err != nil {
+		s.logger.Logger.Error(err.Error(), zap.String("room", query.Room), zap.String("format", query.Format))
+	}
+}
+
+// exportExtension 导出文件扩展名
+func exportExtension(format string) string {
+	switch format {
+	case ExportCSV:
+		return "csv"
+	case ExportText:
+		return "txt"
+	}
+	return "json"
+}
@@ -0,0 +1,309 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  transport
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 11:10 下午
+ */
+
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	TransportSSE  = "sse"  // Server-Sent Events 下行，HTTP POST 上行
+	TransportPoll = "poll" // 长轮询下行，HTTP POST 上行
+
+	defaultPollTimeout     = 25 * time.Second
+	defaultHTTPIdleTimeout = 60 * time.Second
+)
+
+// httpChannel HTTP 传输的连接状态
+type httpChannel struct {
+	transport string
+	mu        sync.Mutex    // 串行处理客户端消息，保证与 websocket 读协程相同的单线程语义
+	poll      chan struct{} // 同一连接同时只允许一个轮询请求
+	lastSeen  int64         // 最后一次轮询或发送消息的时间（纳秒）
+}
+
+func (ch *httpChannel) touch() {
+	atomic.StoreInt64(&ch.lastSeen, time.Now().UnixNano())
+}
+
+// httpConns HTTP 传输的连接索引
+type httpConns struct {
+	mu    sync.Mutex
+	conns map[string]*connection
+}
+
+func (h *httpConns) add(c *connection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns[c.id] = c
+}
+
+func (h *httpConns) remove(c *connection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, c.id)
+}
+
+func (h *httpConns) get(id string) *connection {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.conns[id]
+}
+
+// mountTransports 挂载 HTTP 降级传输，与 websocket 使用相同的消息协议与房间逻辑
+//
+//	GET  {path}/sse              建立 SSE 连接，握手消息中的 conn 为连接标识
+//	GET  {path}/poll             建立长轮询连接并返回握手消息
+//	GET  {path}/poll?conn=<id>   等待并返回待接收的消息数组
+//	POST {path}/send?conn=<id>   发送一条消息或消息数组，ack/nack 经下行通道返回
+func (s *Server) mountTransports(router *mux.Router) {
+	router.HandleFunc(s.config.Path+"/sse", s.serveSSE).Methods(http.MethodGet)
+	router.HandleFunc(s.config.Path+"/poll", s.servePoll).Methods(http.MethodGet)
+	router.HandleFunc(s.config.Path+"/send", s.serveSend).Methods(http.MethodPost)
+}
+
+// openHTTP 创建 HTTP 传输连接
+func (s *Server) openHTTP(w http.ResponseWriter, r *http.Request, transport string) *connection {
+	c, _ := s.open(w, r)
+	if c == nil {
+		return nil
+	}
+	c.id = randomId() + randomId()
+	c.http = &httpChannel{transport: transport, poll: make(chan struct{}, 1)}
+	c.http.touch()
+	if !s.addConn(c) {
+		c.release()
+		http.Error(w, "server shutdown", http.StatusServiceUnavailable)
+		return nil
+	}
+	s.http.add(c)
+	s.connected(c)
+	c.start()
+	return c
+}
+
+// closeHTTP 连接关闭后退出房间并注销连接
+func (s *Server) closeHTTP(c *connection) {
+	c.close(websocket.CloseNormalClosure, "")
+	c.http.mu.Lock()
+	c.disconnect()
+	c.http.mu.Unlock()
+	if c.http.transport == TransportPoll {
+		// 保留一个轮询周期，使客户端取回剩余消息与关闭原因
+		time.AfterFunc(s.config.PollTimeout, func() { s.http.remove(c) })
+	} else {
+		s.http.remove(c)
+	}
+	c.finish()
+}
+
+// serveSSE 以 text/event-stream 持续下发消息，连接在客户端断开或服务端关闭连接时结束
+func (s *Server) serveSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	c := s.openHTTP(w, r, TransportSSE)
+	if c == nil {
+		return
+	}
+	defer s.closeHTTP(c)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(s.config.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.queue.notify:
+			for {
+				message, ok := c.queue.pop()
+				if !ok {
+					break
+				}
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", message); err != nil {
+					return
+				}
+				atomic.AddUint64(&s.metrics.messagesOut, 1)
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			// 注释行作为心跳，防止代理断开空闲连接
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-c.done:
+			if c.closeCode != CloseSlowConsumer {
+				for {
+					message, ok := c.queue.pop()
+					if !ok {
+						break
+					}
+					_, _ = fmt.Fprintf(w, "data: %s\n\n", message)
+				}
+			}
+			_, _ = fmt.Fprintf(w, "event: close\ndata: %s\n\n", closePayload(c))
+			flusher.Flush()
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// servePoll 不带 conn 参数时建立长轮询连接，否则等待消息并以 JSON 数组返回，连接关闭后返回 410
+func (s *Server) servePoll(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("conn")
+	if id == "" {
+		c := s.openHTTP(w, r, TransportPoll)
+		if c == nil {
+			return
+		}
+		go s.watchPoll(c)
+		writeMessages(w, c)
+		return
+	}
+	c := s.http.get(id)
+	if c == nil || c.http.transport != TransportPoll {
+		http.Error(w, "connection not found", http.StatusGone)
+		return
+	}
+	select {
+	case c.http.poll <- struct{}{}:
+		defer func() { <-c.http.poll }()
+	default:
+		http.Error(w, "poll already in progress", http.StatusConflict)
+		return
+	}
+	c.http.touch()
+	defer c.http.touch()
+	timer := time.NewTimer(s.config.PollTimeout)
+	defer timer.Stop()
+wait:
+	for c.queue.len() == 0 {
+		select {
+		case <-c.queue.notify:
+		case <-c.done:
+			break wait
+		case <-timer.C:
+			break wait
+		case <-r.Context().Done():
+			return
+		}
+	}
+	writeMessages(w, c)
+}
+
+// serveSend 接收客户端消息，请求体为一条消息或消息数组
+func (s *Server) serveSend(w http.ResponseWriter, r *http.Request) {
+	c := s.http.get(r.URL.Query().Get("conn"))
+	if c == nil {
+		http.Error(w, "connection not found", http.StatusGone)
+		return
+	}
+	if c.userAgent != r.UserAgent() {
+		http.Error(w, ErrUserAgentMismatch.Error(), http.StatusForbidden)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.config.MaxMessageSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	messages := []json.RawMessage{body}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &messages); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	c.http.touch()
+	c.http.mu.Lock()
+	defer c.http.mu.Unlock()
+	for _, message := range messages {
+		select {
+		case <-c.done:
+			http.Error(w, "connection closed", http.StatusGone)
+			return
+		default:
+		}
+		c.receive(message)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// watchPoll 长轮询连接超过空闲时间未轮询时关闭连接
+func (s *Server) watchPoll(c *connection) {
+	defer s.closeHTTP(c)
+	timeout := s.config.HTTPIdleTimeout
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			idle := time.Since(time.Unix(0, atomic.LoadInt64(&c.http.lastSeen)))
+			if len(c.http.poll) == 0 && idle > timeout {
+				c.close(websocket.CloseGoingAway, "poll timeout")
+				return
+			}
+		}
+	}
+}
+
+// writeMessages 以 JSON 数组返回队列中的消息，连接已关闭且没有剩余消息时返回 410 与关闭原因
+func writeMessages(w http.ResponseWriter, c *connection) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for {
+		message, ok := c.queue.pop()
+		if !ok {
+			break
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(message)
+		atomic.AddUint64(&c.server.metrics.messagesOut, 1)
+	}
+	buf.WriteByte(']')
+	w.Header().Set("Content-Type", "application/json")
+	if buf.Len() == 2 {
+		select {
+		case <-c.done:
+			w.WriteHeader(http.StatusGone)
+			_, _ = w.Write(closePayload(c))
+			return
+		default:
+		}
+	}
+	_, _ = w.Write(buf.Bytes())
+}
+
+// closePayload 连接关闭原因
+func closePayload(c *connection) []byte {
+	data_b, _ := json.Marshal(&NackPayload{Code: c.closeCode, Message: c.closeText})
+	return data_b
+}
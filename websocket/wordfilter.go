@@ -0,0 +1,381 @@
+/**
+ * @Author: Lee
+ * @Description:
+ * @File:  wordfilter
+ * @Version: 1.0.0
+ * @Date: 2026/10/19 11:25 上午
+ */
+
+package websocket
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"go-library/databases"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+var ErrSensitiveWord = errors.New("message contains sensitive words")
+
+// FilterAction 命中敏感词后的处理方式
+type FilterAction int
+
+const (
+	FilterMask   FilterAction = iota // 将敏感词替换为掩码
+	FilterReject                     // 拒绝发送
+	FilterFlag                       // 放行并标记
+)
+
+// WordSource 敏感词来源
+type WordSource interface {
+	Words() ([]string, error)
+}
+
+// FileWordSource 文件敏感词来源，每行一个词，忽略空行与 # 开头的注释
+type FileWordSource struct {
+	Path string
+}
+
+func (s *FileWordSource) Words() ([]string, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
+
+// SensitiveWord 敏感词
+type SensitiveWord struct {
+	Id        int64     `gorm:"primaryKey;autoIncrement" json:"id"` // 记录标识
+	Word      string    `gorm:"size:128;uniqueIndex" json:"word"`   // 敏感词
+	CreatedAt time.Time `json:"created_at"`                         // 创建时间
+}
+
+func (SensitiveWord) TableName() string {
+	return "websocket_sensitive_word"
+}
+
+// GormWordSource 基于 gorm 的敏感词来源
+type GormWordSource struct {
+	db *gorm.DB
+}
+
+// NewGormWordSource 创建数据库敏感词来源并迁移数据表
+func NewGormWordSource(db *databases.GormDB) (*GormWordSource, error) {
+	if err := db.AutoMigrate(&SensitiveWord{}); err != nil {
+		return nil, err
+	}
+	return &GormWordSource{db: db.GetDBClient()}, nil
+}
+
+func (s *GormWordSource) Words() (words []string, err error) {
+	err = s.db.Model(&SensitiveWord{}).Pluck("word", &words).Error
+	return
+}
+
+// PinyinTable 汉字拼音表，用于匹配拼音与汉字混写的敏感词，表中没有的汉字不参与拼音匹配
+type PinyinTable map[rune]string
+
+//go:embed pinyin.txt
+var defaultPinyinData string
+
+var (
+	defaultPinyin     PinyinTable
+	defaultPinyinOnce sync.Once
+)
+
+// DefaultPinyinTable 内置拼音表，收录 GB2312 一二级汉字，多个过滤器共享同一份只读数据
+func DefaultPinyinTable() PinyinTable {
+	defaultPinyinOnce.Do(func() {
+		defaultPinyin, _ = parsePinyinTable(strings.NewReader(defaultPinyinData))
+	})
+	return defaultPinyin
+}
+
+// LoadPinyinTable 从文件加载拼音表，每行格式为 "汉字 拼音"，多音字取第一个读音
+func LoadPinyinTable(path string) (PinyinTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parsePinyinTable(f)
+}
+
+// parsePinyinTable 解析拼音表，跳过空行与 # 开头的注释行
+func parsePinyinTable(src io.Reader) (PinyinTable, error) {
+	table := make(PinyinTable)
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		r := []rune(fields[0])
+		if _, ok := table[r[0]]; len(r) == 1 && !ok {
+			table[r[0]] = strings.ToLower(fields[1])
+		}
+	}
+	return table, scanner.Err()
+}
+
+// WordFilterConfig 敏感词过滤配置
+type WordFilterConfig struct {
+	Words          []string                                 // 固定敏感词
+	Source         WordSource                               // 敏感词来源，与 Words 合并
+	ReloadInterval time.Duration                            // 重新加载 Source 的间隔，为 0 时不自动重新加载
+	Action         FilterAction                             // 命中后的处理方式，默认替换为掩码
+	Mask           rune                                     // 掩码字符，默认 *
+	Pinyin         PinyinTable                              // 拼音表，为空时使用内置拼音表，设置为空表时不做拼音匹配
+	OnFlag         func(msg *FilterMessage, words []string) // 以 FilterFlag 处理时的回调
+	OnError        func(err error)                          // 自动重新加载失败时的回调
+}
+
+// WordFilter 基于 Aho-Corasick 多模式匹配的敏感词过滤器，匹配时忽略全角半角、大小写与词中的符号
+type WordFilter struct {
+	config  *WordFilterConfig
+	matcher atomic.Value // *wordMatcher
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewWordFilter 创建敏感词过滤器，配置了重新加载间隔时启动后台加载协程，使用完毕后调用 Close
+func NewWordFilter(config *WordFilterConfig) (*WordFilter, error) {
+	if config.Mask == 0 {
+		config.Mask = '*'
+	}
+	if config.Pinyin == nil {
+		config.Pinyin = DefaultPinyinTable()
+	}
+	f := &WordFilter{config: config, stop: make(chan struct{})}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	if config.Source != nil && config.ReloadInterval > 0 {
+		go f.watch()
+	}
+	return f, nil
+}
+
+// Reload 重新加载敏感词
+func (f *WordFilter) Reload() error {
+	words := append([]string{}, f.config.Words...)
+	if f.config.Source != nil {
+		loaded, err := f.config.Source.Words()
+		if err != nil {
+			return err
+		}
+		words = append(words, loaded...)
+	}
+	f.matcher.Store(newWordMatcher(words, f.config.Pinyin))
+	return nil
+}
+
+// Close 停止后台加载协程
+func (f *WordFilter) Close() {
+	f.stopOnce.Do(func() { close(f.stop) })
+}
+
+func (f *WordFilter) watch() {
+	ticker := time.NewTicker(f.config.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := f.Reload(); err != nil && f.config.OnError != nil {
+				f.config.OnError(err)
+			}
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// Match 返回内容中命中的敏感词
+func (f *WordFilter) Match(content string) []string {
+	m := f.matcher.Load().(*wordMatcher)
+	var words []string
+	seen := make(map[int]bool)
+	for _, hit := range m.match(content) {
+		if !seen[hit.word] {
+			seen[hit.word] = true
+			words = append(words, m.words[hit.word])
+		}
+	}
+	return words
+}
+
+// Filter 按配置的处理方式过滤消息
+func (f *WordFilter) Filter(msg *FilterMessage) error {
+	m := f.matcher.Load().(*wordMatcher)
+	hits := m.match(msg.Content)
+	if len(hits) == 0 {
+		return nil
+	}
+	switch f.config.Action {
+	case FilterReject:
+		return newProtocolError(CodeContentRejected, ErrSensitiveWord.Error())
+	case FilterFlag:
+		msg.Flag("sensitive word")
+		if f.config.OnFlag != nil {
+			f.config.OnFlag(msg, f.Match(msg.Content))
+		}
+	default:
+		runes := []rune(msg.Content)
+		for _, hit := range hits {
+			for i := hit.start; i <= hit.end; i++ {
+				runes[i] = f.config.Mask
+			}
+		}
+		msg.Content = string(runes)
+	}
+	return nil
+}
+
+// wordHit 命中位置，start、end 为原文中的字符下标（包含）
+type wordHit struct {
+	word  int
+	start int
+	end   int
+}
+
+// wordNode Aho-Corasick 自动机节点
+type wordNode struct {
+	next    map[rune]int
+	fail    int
+	outputs []int // 以该节点结尾的敏感词，包含失败链上的敏感词
+}
+
+// wordMatcher 构建完成后只读的敏感词自动机
+type wordMatcher struct {
+	words   []string
+	lengths []int // 敏感词规范化后的长度
+	nodes   []wordNode
+	pinyin  PinyinTable
+}
+
+func newWordMatcher(words []string, pinyin PinyinTable) *wordMatcher {
+	m := &wordMatcher{nodes: []wordNode{{next: make(map[rune]int)}}, pinyin: pinyin}
+	for _, word := range words {
+		normalized, _ := m.normalize(word)
+		if len(normalized) == 0 {
+			continue
+		}
+		node := 0
+		for _, r := range normalized {
+			child, ok := m.nodes[node].next[r]
+			if !ok {
+				child = len(m.nodes)
+				m.nodes = append(m.nodes, wordNode{next: make(map[rune]int)})
+				m.nodes[node].next[r] = child
+			}
+			node = child
+		}
+		m.nodes[node].outputs = append(m.nodes[node].outputs, len(m.words))
+		m.words = append(m.words, word)
+		m.lengths = append(m.lengths, len(normalized))
+	}
+	// 按层构建失败指针
+	queue := make([]int, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for r, child := range m.nodes[node].next {
+			fail := m.nodes[node].fail
+			for fail > 0 {
+				if _, ok := m.nodes[fail].next[r]; ok {
+					break
+				}
+				fail = m.nodes[fail].fail
+			}
+			if next, ok := m.nodes[fail].next[r]; ok && next != child {
+				fail = next
+			}
+			m.nodes[child].fail = fail
+			m.nodes[child].outputs = append(m.nodes[child].outputs, m.nodes[fail].outputs...)
+			queue = append(queue, child)
+		}
+	}
+	return m
+}
+
+// normalize 规范化文本：全角转半角、转小写、去除符号与空白、汉字转拼音，返回规范化后的字符及其在原文中的下标
+func (m *wordMatcher) normalize(text string) ([]rune, []int) {
+	normalized := make([]rune, 0, len(text))
+	index := make([]int, 0, len(text))
+	for i, r := range []rune(text) {
+		r = toHalfWidth(r)
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			continue
+		}
+		if py, ok := m.pinyin[r]; ok && m.pinyin != nil {
+			for _, p := range py {
+				normalized = append(normalized, p)
+				index = append(index, i)
+			}
+			continue
+		}
+		normalized = append(normalized, unicode.ToLower(r))
+		index = append(index, i)
+	}
+	return normalized, index
+}
+
+// match 查找文本中的所有敏感词
+func (m *wordMatcher) match(text string) []wordHit {
+	if len(m.words) == 0 {
+		return nil
+	}
+	normalized, index := m.normalize(text)
+	var hits []wordHit
+	node := 0
+	for i, r := range normalized {
+		for node > 0 {
+			if _, ok := m.nodes[node].next[r]; ok {
+				break
+			}
+			node = m.nodes[node].fail
+		}
+		if next, ok := m.nodes[node].next[r]; ok {
+			node = next
+		}
+		for _, word := range m.nodes[node].outputs {
+			hits = append(hits, wordHit{word: word, start: index[i-m.lengths[word]+1], end: index[i]})
+		}
+	}
+	return hits
+}
+
+// toHalfWidth 全角字符转半角
+func toHalfWidth(r rune) rune {
+	switch {
+	case r == 0x3000:
+		return ' '
+	case r >= 0xFF01 && r <= 0xFF5E:
+		return r - 0xFEE0
+	}
+	return r
+}